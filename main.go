@@ -1,19 +1,36 @@
 package main // import "github.com/MYOB-OSS/hubr"
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"debug/elf"
 	"debug/macho"
 	"debug/pe"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -23,7 +40,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -31,12 +51,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/google/go-github/github"
+	"github.com/ulikunitz/xz"
 	"golang.org/x/oauth2"
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -45,18 +67,49 @@ const (
 
 	// the number of parallel uploads or downloads
 	workers = 3
+
+	// the number of results requested per page of a list call
+	perPage = 100
 )
 
 var (
 	// the default org/owner if not supplied
 	defaultOrg = ""
 
-	// default auth chain (key:value,key:value)
+	// default auth chain (key:value,key:value), see -auth
 	defaultChain = "env:GITHUB_API_TOKEN,env:TOKEN"
 
 	// context used for github calls
 	ctxbg = context.Background()
 
+	// the maximum number of pages read by a list call, zero is unlimited
+	pageLimit = 0
+
+	// the maximum number of attempts made for a github or download request
+	retries = 5
+
+	// http client used for github calls and downloads, retries transient errors
+	// and caches github responses
+	httpClient = &http.Client{Transport: cacher{retrier{http.DefaultTransport}}}
+
+	// answer github requests from the response cache only, see -offline
+	offline = false
+
+	// the GitHub Enterprise Server url, empty for github.com
+	githubURL = ""
+
+	// the GitHub Enterprise Server upload url, empty to derive from githubURL
+	githubUploadURL = ""
+
+	// progress of uploads and downloads, see -q
+	prog = newMeter(os.Stderr, true)
+
+	// the download cache directory, empty to disable, see cache
+	cacheDir = defaultCacheDir()
+
+	// the maximum size of the download cache in bytes, zero is unlimited
+	cacheMax int64 = 2 << 30
+
 	// hubr version, set at build time
 	// -ldflags="-X main.hubr=$(head -n 1 VERSION)"
 	hubr = "unknown"
@@ -71,6 +124,50 @@ func init() {
 	if org, ok := os.LookupEnv("HUBR_DEFAULT_ORG"); ok {
 		defaultOrg = org
 	}
+	if c, ok := os.LookupEnv("HUBR_AUTH_CHAIN"); ok {
+		defaultChain = c
+	} else if inActions() {
+		defaultChain += ",actions:GITHUB_TOKEN"
+	}
+	if u, ok := os.LookupEnv("HUBR_GITHUB_URL"); ok {
+		githubURL = u
+	} else if u := actionsEnv("GITHUB_SERVER_URL"); u != "" && u != "https://github.com" {
+		githubURL = u
+	}
+	if u, ok := os.LookupEnv("HUBR_GITHUB_UPLOAD_URL"); ok {
+		githubUploadURL = u
+	}
+	if s, ok := os.LookupEnv("HUBR_RETRIES"); ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			log.Fatalf("HUBR_RETRIES: not an attempt count: %s", s)
+		}
+		retries = n
+	}
+	if s, ok := os.LookupEnv("HUBR_PAGE_LIMIT"); ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			log.Fatalf("HUBR_PAGE_LIMIT: not a page count: %s", s)
+		}
+		pageLimit = n
+	}
+	if d, ok := os.LookupEnv("HUBR_CACHE"); ok {
+		cacheDir = d
+	}
+	if s, ok := os.LookupEnv("HUBR_OFFLINE"); ok {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			log.Fatalf("HUBR_OFFLINE: not a boolean: %s", s)
+		}
+		offline = b
+	}
+	if s, ok := os.LookupEnv("HUBR_CACHE_MAX"); ok {
+		n, err := parseSize(s)
+		if err != nil {
+			log.Fatalf("HUBR_CACHE_MAX: %s", err)
+		}
+		cacheMax = n
+	}
 }
 
 // asset is a GitHub release asset and a pointer to the release
@@ -78,6 +175,8 @@ type asset struct {
 	github.ReleaseAsset
 	Release *github.RepositoryRelease
 	id      ident
+	sums    *github.ReleaseAsset // the checksum manifest of the release, if any
+	sig     *github.ReleaseAsset // the detached signature of the asset, if any
 }
 
 // client is a wrapper over the github client.
@@ -86,44 +185,454 @@ type client struct {
 }
 
 // NewClient creates a new client. It attempts to acquire a GitHub token from
-// the auth chain defined by the global defaultChain.
-// The chain takes the form of a string "k:v,k:v,k:v".
-// - key "env" calls os.Getenv(v)
-// - key "ssm" calls ssmGet(v)
-// The first result which is not missing is used for GitHub authentication.
+// the auth chain defined by the global defaultChain, see authChain.
 // If no result is found hubr will attempt to invoke a git credential helper.
 func newClient() (*client, error) {
+	ts, err := authChain(defaultChain)
+	if err != nil {
+		return nil, err
+	}
+	tc := oauth2.NewClient(context.WithValue(ctxbg, oauth2.HTTPClient, httpClient), ts)
+	gc, err := newGitHub(tc)
+	if err != nil {
+		return nil, err
+	}
+	return &client{Client: gc}, nil
+}
+
+// authChain returns a token source for the first entry of the chain which
+// yields a token. The chain takes the form of a string "k:v,k:v,k:v", where
+// a comma in a value is escaped as "\,", see splitChain.
+// - key "env" calls os.Getenv(v)
+// - key "file" reads the file at path v
+// - key "exec" runs the command v with sh and reads its standard output
+// - key "keyring" looks up the service v in the os keyring
+// - key "ssm" calls ssmGet(v)
+// - key "app" makes GitHub App installation tokens, see appSource
+// - key "actions" calls os.Getenv(v) only when running in GitHub Actions
+// If no entry yields a token the git credential helper is tried last.
+func authChain(chain string) (oauth2.TokenSource, error) {
 	var err error
-	var token string
-	for _, p := range strings.Split(defaultChain, ",") {
-		kv := strings.Split(p, ":")
-		if len(kv) != 2 {
+	for _, p := range splitChain(chain) {
+		kv := strings.SplitN(strings.TrimSpace(p), ":", 2)
+		if len(kv) != 2 || kv[1] == "" {
 			return nil, fmt.Errorf("invalid auth chain value: %v", p)
 		}
-		switch kv[0] {
-		case "env":
-			token = os.Getenv(kv[1])
-		case "ssm":
-			token, err = ssmGet(kv[1])
-		default:
-			return nil, fmt.Errorf("invalid auth chain value: %v", p)
+		if kv[0] == "app" {
+			s, e := newAppSource(kv[1])
+			if e != nil {
+				return nil, fmt.Errorf("auth chain %s: %s", p, e)
+			}
+			if s == nil || offline {
+				continue
+			}
+			// the first token is made now so that a bad app falls through
+			t, e := s.Token()
+			if e != nil {
+				err = e
+				continue
+			}
+			return oauth2.ReuseTokenSource(t, s), nil
+		}
+		token, e := authLookup(kv[0], kv[1])
+		if e != nil {
+			if _, ok := e.(errAuthKey); ok {
+				return nil, e
+			}
+			err = e
 		}
 		if token != "" {
-			break
+			return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+		}
+	}
+	if token := credHelper(); token != "" {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth chain failed: %v", err)
+	}
+	return nil, fmt.Errorf("auth chain failed: " + chain)
+}
+
+// splitChain splits an auth chain at each comma which is not escaped by a
+// backslash, so that a value such as an exec command may contain commas. The
+// backslash of an escaped comma is removed, any other backslash is kept.
+func splitChain(chain string) []string {
+	var (
+		ps []string
+		b  strings.Builder
+	)
+	for i := 0; i < len(chain); i++ {
+		switch {
+		case chain[i] == '\\' && i+1 < len(chain) && chain[i+1] == ',':
+			b.WriteByte(',')
+			i++
+		case chain[i] == ',':
+			ps = append(ps, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(chain[i])
+		}
+	}
+	return append(ps, b.String())
+}
+
+// errAuthKey is the error of an auth chain entry with an unknown key.
+type errAuthKey string
+
+func (e errAuthKey) Error() string {
+	return "invalid auth chain value: " + string(e)
+}
+
+// authLookup returns the secret of a single auth chain entry k:v. A missing
+// secret is an empty string and nil error, so that the chain may continue.
+func authLookup(k, v string) (string, error) {
+	switch k {
+	case "env":
+		return os.Getenv(v), nil
+	case "file":
+		if strings.HasPrefix(v, "~/") {
+			v = filepath.Join(os.Getenv("HOME"), v[2:])
 		}
+		b, err := ioutil.ReadFile(v)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return strings.TrimSpace(string(b)), err
+	case "exec":
+		b, err := runSecret("/bin/sh", "-c", v)
+		if err != nil {
+			return "", fmt.Errorf("exec %s: %s", v, err)
+		}
+		return b, nil
+	case "keyring":
+		return keyringGet(v)
+	case "ssm":
+		if offline {
+			return "", nil
+		}
+		return ssmGet(v)
+	case "actions":
+		return actionsEnv(v), nil
+	}
+	return "", errAuthKey(k + ":" + v)
+}
+
+// runSecret runs a command and returns its trimmed standard output. The
+// command is killed after five seconds, as with credHelper.
+func runSecret(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctxbg, 5*time.Second)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", errors.New("timeout: 5sec")
+	}
+	if err != nil {
+		if m := strings.TrimSpace(stderr.String()); m != "" {
+			return "", fmt.Errorf("%s: %s", err, m)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// keyringGet looks up a password in the os keyring. The service s may name an
+// account as service/account. On macOS the login keychain is read with
+// security, elsewhere the secret service is read with secret-tool. A missing
+// entry is an empty string and nil error.
+func keyringGet(s string) (string, error) {
+	svc, acct := s, ""
+	if i := strings.LastIndex(s, "/"); i > 0 {
+		svc, acct = s[:i], s[i+1:]
+	}
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name, args = "security", []string{"find-generic-password", "-w", "-s", svc}
+		if acct != "" {
+			args = append(args, "-a", acct)
+		}
+	case "windows":
+		return "", errors.New("keyring: not supported on windows")
+	default:
+		name, args = "secret-tool", []string{"lookup", "service", svc}
+		if acct != "" {
+			args = append(args, "account", acct)
+		}
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("keyring: %s", err)
+	}
+	t, err := runSecret(name, args...)
+	if _, ok := err.(*exec.ExitError); ok {
+		// both tools exit non-zero when there is no such entry
+		return "", nil
+	}
+	return t, err
+}
+
+// appSource is an oauth2.TokenSource of GitHub App installation tokens. Each
+// token is requested with a JWT signed by the app private key, and expires
+// after an hour. Wrap it with oauth2.ReuseTokenSource to refresh on expiry.
+type appSource struct {
+	app  int64 // the app id
+	inst int64 // the installation id, found on first use if zero
+	key  *rsa.PrivateKey
+}
+
+// newAppSource parses the value of an app auth chain entry, which takes the
+// form "<app id>[/<installation id>]:<k>:<v>". The private key of the app is
+// the secret of the auth chain entry k:v, for example file:app.pem or
+// env:APP_KEY. If the key is missing newAppSource returns nil and nil error.
+func newAppSource(v string) (*appSource, error) {
+	p := strings.SplitN(v, ":", 3)
+	if len(p) != 3 {
+		return nil, errors.New("want app:<app id>[/<installation id>]:<key source>")
+	}
+	var s appSource
+	ids := strings.SplitN(p[0], "/", 2)
+	var err error
+	if s.app, err = strconv.ParseInt(ids[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("app id: %s", ids[0])
+	}
+	if len(ids) == 2 {
+		if s.inst, err = strconv.ParseInt(ids[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("installation id: %s", ids[1])
+		}
+	}
+	pk, err := authLookup(p[1], p[2])
+	if err != nil || pk == "" {
+		return nil, err
+	}
+	// keys in env vars and parameters are often stored with escaped newlines
+	pk = strings.Replace(pk, `\n`, "\n", -1)
+	b, _ := pem.Decode([]byte(pk))
+	if b == nil {
+		return nil, errors.New("private key: not a pem block")
 	}
-	if token == "" {
-		token = credHelper()
+	if s.key, err = x509.ParsePKCS1PrivateKey(b.Bytes); err != nil {
+		k, e := x509.ParsePKCS8PrivateKey(b.Bytes)
+		if e != nil {
+			return nil, fmt.Errorf("private key: %s", err)
+		}
+		var ok bool
+		if s.key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("private key: not an rsa key")
+		}
+	}
+	return &s, nil
+}
+
+// Token implements oauth2.TokenSource. If no installation id was given, the
+// installation on the default org is used, or the only installation of the
+// app.
+func (s *appSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// app requests are not cached, the responses belong to the app
+	hc := &http.Client{Transport: retrier{http.DefaultTransport}}
+	tc := oauth2.NewClient(context.WithValue(ctxbg, oauth2.HTTPClient, hc),
+		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt}))
+	gc, err := newGitHub(tc)
+	if err != nil {
+		return nil, err
 	}
-	if token == "" {
+	if s.inst == 0 {
+		var is []*github.Installation
+		err := paginate(func(opt *github.ListOptions) (*github.Response, bool, error) {
+			page, rsp, err := gc.Apps.ListInstallations(ctxbg, opt)
+			is = append(is, page...)
+			return rsp, true, err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("auth chain failed: %v", err)
+			return nil, fmt.Errorf("app %d: %s", s.app, err)
+		}
+		for _, i := range is {
+			if len(is) == 1 || strings.EqualFold(i.GetAccount().GetLogin(), defaultOrg) {
+				s.inst = i.GetID()
+				break
+			}
+		}
+		if s.inst == 0 {
+			return nil, fmt.Errorf("app %d: %d installations, none on the default org, use app:%d/<installation id>",
+				s.app, len(is), s.app)
+		}
+	}
+	// go-github uses the retired /installations path, so the request is made here
+	req, err := gc.NewRequest(http.MethodPost, fmt.Sprintf("app/installations/%d/access_tokens", s.inst), nil)
+	if err != nil {
+		return nil, err
+	}
+	var t github.InstallationToken
+	if _, err := gc.Do(ctxbg, req, &t); err != nil {
+		return nil, fmt.Errorf("app %d installation %d: %s", s.app, s.inst, err)
+	}
+	return &oauth2.Token{AccessToken: t.GetToken(), Expiry: t.GetExpiresAt()}, nil
+}
+
+// jwt returns a JWT for the app issued at time t. It is backdated a minute to
+// allow for clock drift and expires after nine, under GitHub's limit of ten.
+func (s *appSource) jwt(t time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	h := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	c, err := json.Marshal(map[string]int64{
+		"iat": t.Add(-time.Minute).Unix(),
+		"exp": t.Add(9 * time.Minute).Unix(),
+		"iss": s.app,
+	})
+	if err != nil {
+		return "", err
+	}
+	m := h + "." + enc.EncodeToString(c)
+	d := sha256.Sum256([]byte(m))
+	sig, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, d[:])
+	if err != nil {
+		return "", err
+	}
+	return m + "." + enc.EncodeToString(sig), nil
+}
+
+// anonClient creates a new client without a token. It is used by subcmds that
+// can proceed unauthenticated when the auth chain fails.
+func anonClient() *client {
+	gc, err := newGitHub(httpClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &client{Client: gc}
+}
+
+// newGitHub creates a github client using hc for requests. If githubURL is
+// set, the client is pointed at that GitHub Enterprise Server instead of
+// github.com.
+func newGitHub(hc *http.Client) (*github.Client, error) {
+	if githubURL == "" {
+		return github.NewClient(hc), nil
+	}
+	api, upl, err := enterpriseURLs(githubURL, githubUploadURL)
+	if err != nil {
+		return nil, err
+	}
+	return github.NewEnterpriseClient(api, upl, hc)
+}
+
+// enterpriseURLs returns the api and upload base urls for a GitHub Enterprise
+// Server. A bare host url such as https://ghe.example.com is expanded to the
+// /api/v3/ path. If upload is empty it is derived from the api url.
+func enterpriseURLs(base, upload string) (string, string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", "", fmt.Errorf("github url: %s", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", fmt.Errorf("github url: %s is not an absolute url", base)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/api/v3/"
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	if upload == "" {
+		v := *u
+		v.Path = strings.Replace(u.Path, "/api/v3/", "/api/uploads/", 1)
+		upload = v.String()
+	}
+	return u.String(), upload, nil
+}
+
+// githubHost returns the host name used for git credentials, which is
+// github.com unless githubURL is set.
+func githubHost() string {
+	if githubURL == "" {
+		return "github.com"
+	}
+	u, err := url.Parse(githubURL)
+	if err != nil || u.Host == "" {
+		return "github.com"
+	}
+	return u.Host
+}
+
+// inActions reports whether hubr is running in a GitHub Actions workflow.
+func inActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// actionsEnv returns the value of the environment variable k when running in
+// GitHub Actions, and an empty string otherwise.
+func actionsEnv(k string) string {
+	if !inActions() {
+		return ""
+	}
+	return os.Getenv(k)
+}
+
+// actionsArgs defaults the leading <repo> argument of args to the repository
+// of the workflow when running in GitHub Actions. The argument is defaulted
+// only if there are no args or it is the placeholder ".", never by guessing
+// whether it is a file. If tag is true the argument is <repo>@<tag>: it may
+// be given as @<tag>, and if defaulted the tag is the ref of a tag push
+// workflow.
+func actionsArgs(args []string, tag bool) []string {
+	repo := actionsEnv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return args
+	}
+	rest := args
+	if len(args) > 0 {
+		switch {
+		case tag && strings.HasPrefix(args[0], "@"):
+			return append([]string{repo + args[0]}, args[1:]...)
+		case args[0] != ".":
+			return args
+		}
+		rest = args[1:]
+	}
+	if tag {
+		ref := os.Getenv("GITHUB_REF")
+		if !strings.HasPrefix(ref, "refs/tags/") {
+			return args
+		}
+		repo += "@" + strings.TrimPrefix(ref, "refs/tags/")
+	}
+	return append([]string{repo}, rest...)
+}
+
+// setOutputs appends the step outputs k, v, k, v... to the file named by env
+// GITHUB_OUTPUT when running in GitHub Actions. Values spanning lines are
+// written with a delimiter derived from the value, so it cannot occur in it.
+func setOutputs(kvs ...string) error {
+	p := actionsEnv("GITHUB_OUTPUT")
+	if p == "" {
+		return nil
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(kvs); i += 2 {
+		k, v := kvs[i], kvs[i+1]
+		if !strings.ContainsAny(v, "\r\n") {
+			fmt.Fprintf(&b, "%s=%s\n", k, v)
+			continue
 		}
-		return nil, fmt.Errorf("auth chain failed: " + defaultChain)
+		h := sha256.Sum256([]byte(v))
+		d := "hubr_" + hex.EncodeToString(h[:8])
+		fmt.Fprintf(&b, "%s<<%s\n%s\n%s\n", k, d, v, d)
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("step outputs: %s", err)
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("step outputs: %s", err)
 	}
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctxbg, ts)
-	return &client{Client: github.NewClient(tc)}, nil
+	return f.Close()
 }
 
 // CreateRelease creates a GitHub release with the given tag, name and body.
@@ -131,7 +640,7 @@ func newClient() (*client, error) {
 // If pre is true the release will be a prerelease.
 func (c *client) CreateRelease(id ident, name, body string, pre bool) error {
 	r, rsp, err := c.Repositories.GetReleaseByTag(ctxbg, id.org, id.repo, id.tag)
-	if rsp.StatusCode != http.StatusNotFound {
+	if rsp == nil || rsp.StatusCode != http.StatusNotFound {
 		if err != nil {
 			return err
 		}
@@ -174,10 +683,14 @@ func (c *client) DraftRelease(id ident, name, body string, pre bool) (*github.Re
 	return r, err
 }
 
-// ListReleases returns a slice of releases for the given repo.
+// ListReleases returns a slice of all releases for the given repo, newest
+// first. Every page is read, up to the page limit.
 func (c *client) ListReleases(id ident) ([]*github.RepositoryRelease, error) {
-	rs, _, err := c.Repositories.ListReleases(ctxbg, id.org, id.repo,
-		&github.ListOptions{Page: 0})
+	rs := []*github.RepositoryRelease{}
+	err := c.EachRelease(id, func(r *github.RepositoryRelease) bool {
+		rs = append(rs, r)
+		return true
+	})
 	if err != nil {
 		return []*github.RepositoryRelease{}, err
 	}
@@ -185,20 +698,41 @@ func (c *client) ListReleases(id ident) ([]*github.RepositoryRelease, error) {
 	return rs, nil
 }
 
+// EachRelease calls fn for each release of the given repo, newest first,
+// fetching further pages as required. Iteration stops when fn returns false.
+func (c *client) EachRelease(id ident, fn func(*github.RepositoryRelease) bool) error {
+	return paginate(func(opt *github.ListOptions) (*github.Response, bool, error) {
+		rs, rsp, err := c.Repositories.ListReleases(ctxbg, id.org, id.repo, opt)
+		if err != nil {
+			return rsp, false, err
+		}
+		for _, r := range rs {
+			if !fn(r) {
+				return rsp, false, nil
+			}
+		}
+		return rsp, true, nil
+	})
+}
+
 // GetDraft returns the first release with a matching tag. The returned release
 // may or may not actually be a draft.
 func (c *client) GetDraft(id ident) (*github.RepositoryRelease, error) {
-	rs, err := c.ListReleases(id)
+	var d *github.RepositoryRelease
+	err := c.EachRelease(id, func(r *github.RepositoryRelease) bool {
+		if id.tag == r.GetTagName() {
+			d = r
+			return false
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	for _, r := range rs {
-		if id.tag == r.GetTagName() {
-			return r, nil
-		}
+	if d == nil {
+		return nil, errNotFound{id}
 	}
-	return nil, errNotFound{id}
+	return d, nil
 }
 
 // GetRelease returns the release for a given tag, which may be "latest" for the
@@ -211,25 +745,72 @@ func (c *client) GetRelease(id ident) (*github.RepositoryRelease, error) {
 
 	switch id.tag {
 	case "edge":
-		rs, err := c.ListReleases(id)
+		err := c.EachRelease(id, func(e *github.RepositoryRelease) bool {
+			r = e
+			return false
+		})
 		if err != nil {
 			return nil, err
 		}
-		if len(rs) == 0 {
+		if r == nil {
 			return nil, errNoReleases{id}
 		}
-		return rs[0], nil
+		return r, nil
 	case "stable":
 		fallthrough
 	case defaultTag:
 		r, _, err = c.Repositories.GetLatestRelease(ctxbg, id.org, id.repo)
 	default:
+		if isConstraint(id.tag) {
+			return c.MatchRelease(id)
+		}
 		r, _, err = c.Repositories.GetReleaseByTag(ctxbg, id.org, id.repo, id.tag)
 	}
 
 	return r, err
 }
 
+// MatchRelease returns the release with the highest version satisfying the
+// semver constraint in the tag of id. Every release is considered. Drafts never
+// match. Prereleases only match if the constraint mentions a prerelease. Only
+// releases with the tag prefix of the constraint are considered, such as the
+// svc-a/ of svc-a/^1.2, and without one only tags without a prefix.
+func (c *client) MatchRelease(id ident) (*github.RepositoryRelease, error) {
+	prefix, cs, err := tagConstraint(id.tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		r *github.RepositoryRelease
+		v version
+	)
+	err = c.EachRelease(id, func(e *github.RepositoryRelease) bool {
+		if e.GetDraft() || (e.GetPrerelease() && !cs.pre()) {
+			return true
+		}
+		n := e.GetTagName()
+		if !strings.HasPrefix(n, prefix) || strings.Contains(n[len(prefix):], "/") {
+			return true
+		}
+		u, err := parseVersion(n[len(prefix):])
+		if err != nil || !cs.match(u) {
+			return true
+		}
+		if r == nil || v.isBefore(u) {
+			r, v = e, u
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errNotFound{id}
+	}
+	return r, nil
+}
+
 // PublishRelease changes a release from draft to not draft. If the release
 // does not exist an error is returned. If the release exists and is not a
 // draft nothing happens and no error is returned.
@@ -269,7 +850,7 @@ func (c *client) PublishRelease(id ident) error {
 func (c *client) CreateTag(id ident, sha, msg string) error {
 	refstr := "tags/" + id.tag
 	ref, rsp, err := c.Git.GetRef(ctxbg, id.org, id.repo, refstr)
-	if rsp.StatusCode != http.StatusNotFound {
+	if rsp == nil || rsp.StatusCode != http.StatusNotFound {
 		if err != nil {
 			return err
 		}
@@ -280,7 +861,7 @@ func (c *client) CreateTag(id ident, sha, msg string) error {
 			return errors.New("ref " + refstr + " exists on github and the sha is incorrect")
 		}
 		t, rsp, err := c.Git.GetTag(ctxbg, id.org, id.repo, ref.GetObject().GetSHA())
-		if rsp.StatusCode != http.StatusNotFound {
+		if rsp == nil || rsp.StatusCode != http.StatusNotFound {
 			if err != nil {
 				return err
 			}
@@ -294,7 +875,7 @@ func (c *client) CreateTag(id ident, sha, msg string) error {
 
 	_, rsp, err = c.Repositories.GetCommit(ctxbg, id.org, id.repo, sha)
 	if err != nil {
-		if rsp.StatusCode == 422 {
+		if rsp != nil && rsp.StatusCode == 422 {
 			return fmt.Errorf("create tag %s: sha %s not found, is the commit pushed?",
 				id.String(), sha)
 		}
@@ -334,9 +915,25 @@ func (c *client) GlobAssets(id ident) ([]asset, error) {
 		return []asset{}, fmt.Errorf("get asset: %s", err)
 	}
 
+	ras, err := c.ListAssets(id, r)
+	if err != nil {
+		return []asset{}, fmt.Errorf("list assets: %s", err)
+	}
+
+	var sa *github.ReleaseAsset
+	sigs := map[string]*github.ReleaseAsset{}
+	for i := range ras {
+		if ras[i].GetName() == sumsName {
+			sa = &ras[i]
+		}
+		if strings.HasSuffix(ras[i].GetName(), sigExt) {
+			sigs[strings.TrimSuffix(ras[i].GetName(), sigExt)] = &ras[i]
+		}
+	}
+
 	id.tag = r.GetTagName()
 	as := []asset{}
-	for _, a := range r.Assets {
+	for _, a := range ras {
 		ok, err := filepath.Match(id.asset, a.GetName())
 		if err != nil {
 			return []asset{}, fmt.Errorf("%s: %s", id, err)
@@ -356,7 +953,7 @@ func (c *client) GlobAssets(id ident) ([]asset, error) {
 			nid.dst = nid.asset
 		}
 
-		as = append(as, asset{a, r, nid})
+		as = append(as, asset{a, r, nid, sa, sigs[a.GetName()]})
 	}
 	if len(as) == 0 {
 		return as, errNotFound{id}
@@ -364,138 +961,311 @@ func (c *client) GlobAssets(id ident) ([]asset, error) {
 	return as, nil
 }
 
-// List tags lists all the tag refs for a repo.
+// List tags lists all the tag refs for a repo. Every page is read, up to the
+// page limit.
 func (c *client) ListTags(id ident) ([]string, error) {
-	ts, _, err := c.Repositories.ListTags(ctxbg, id.org, id.repo,
-		&github.ListOptions{Page: 0})
+	ss := []string{}
+	err := paginate(func(opt *github.ListOptions) (*github.Response, bool, error) {
+		ts, rsp, err := c.Repositories.ListTags(ctxbg, id.org, id.repo, opt)
+		if err != nil {
+			return rsp, false, err
+		}
+		for _, t := range ts {
+			ss = append(ss, t.GetName())
+		}
+		return rsp, true, nil
+	})
 	if err != nil {
 		return []string{}, err
 	}
-	ss := make([]string, len(ts))
-	for i, t := range ts {
-		ss[i] = t.GetName()
-	}
 	return ss, nil
 }
 
-// downer performs downloaads using parallel workers. Call queue(dir, as) to
-// append a slice of assets to download, such as returned by client.GlobAssets.
-// Call wait() to wait on the workers and collect any errors.
-// Attempting to queue after a wait will cause a panic.
-type downer struct {
-	c     *client
-	queue func(string, []asset)
-	wait  func() []error
+// ListAssets lists all the assets of a release. A release returned by the API
+// only includes the first page of its assets. Every page is read, up to the
+// page limit.
+func (c *client) ListAssets(id ident, r *github.RepositoryRelease) ([]github.ReleaseAsset, error) {
+	as := []github.ReleaseAsset{}
+	err := paginate(func(opt *github.ListOptions) (*github.Response, bool, error) {
+		ras, rsp, err := c.Repositories.ListReleaseAssets(ctxbg, id.org, id.repo, r.GetID(), opt)
+		if err != nil {
+			return rsp, false, err
+		}
+		for _, a := range ras {
+			as = append(as, *a)
+		}
+		return rsp, true, nil
+	})
+	if err != nil {
+		return []github.ReleaseAsset{}, err
+	}
+	return as, nil
 }
 
-// newDowner creates a new downer using a client and a number of
-// parallel workers. Calling newDowner starts the worker pool.
-func newDowner(c *client, wkrs int) downer {
-	type dl struct {
-		dir string
-		a   asset
+// OpenAsset opens the contents of a release asset for reading. The caller
+// must close the returned reader.
+func (c *client) OpenAsset(id ident, a *github.ReleaseAsset) (io.ReadCloser, error) {
+	return c.OpenAssetAt(id, a, 0)
+}
+
+// OpenAssetAt opens the contents of a release asset for reading from the
+// byte offset off. The redirect url is requested with a Range header, if the
+// range is not honoured the leading bytes are skipped instead. The caller
+// must close the returned reader.
+func (c *client) OpenAssetAt(id ident, a *github.ReleaseAsset, off int64) (io.ReadCloser, error) {
+	rc, rd, err := c.Repositories.DownloadReleaseAsset(ctxbg, id.org, id.repo, a.GetID())
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		return skipBytes(rc, off)
 	}
 
-	dlc := make(chan dl)
-	done := make(chan struct{})
-	errs, eall := erraggr()
+	req, err := http.NewRequest(http.MethodGet, rd, nil)
+	if err != nil {
+		return nil, fmt.Errorf("redirect: %s", err)
+	}
+	if off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("redirect: %s", err)
+	}
+	switch {
+	case off > 0 && rsp.StatusCode == http.StatusPartialContent:
+		return rsp.Body, nil
+	case rsp.StatusCode == http.StatusOK:
+		return skipBytes(rsp.Body, off)
+	}
+	rsp.Body.Close()
+	return nil, fmt.Errorf("redirect: %s", rsp.Status)
+}
 
-	d := downer{
-		c: c,
-		queue: func(dir string, as []asset) {
-			for _, a := range as {
-				dlc <- dl{dir, a}
-			}
-		},
-		wait: func() []error {
-			close(dlc)
-			for i := 0; i < wkrs; i++ {
-				<-done
-			}
-			return <-eall
-		},
+// skipBytes discards the first n bytes of rc.
+func skipBytes(rc io.ReadCloser, n int64) (io.ReadCloser, error) {
+	if n == 0 {
+		return rc, nil
+	}
+	if _, err := io.CopyN(ioutil.Discard, rc, n); err != nil {
+		rc.Close()
+		return nil, err
 	}
+	return rc, nil
+}
 
-	for i := 0; i < wkrs; i++ {
-		go func() {
-			for v := range dlc {
-				errs <- d.download(v.dir, v.a)
-			}
-			done <- struct{}{}
-		}()
+// GetSums downloads and parses the checksum manifest asset a of a release.
+func (c *client) GetSums(id ident, a *github.ReleaseAsset) (sums, error) {
+	b, err := c.ReadAsset(id, a)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %s", sumsName, err)
 	}
+	return parseSums(bytes.NewReader(b))
+}
 
-	return d
+// ReadAsset reads the contents of a small release asset a, such as a
+// checksum manifest or signature, from the download cache or by downloading
+// and caching it.
+func (c *client) ReadAsset(id ident, a *github.ReleaseAsset) ([]byte, error) {
+	id.asset, id.dst = a.GetName(), a.GetName()
+	ca := asset{ReleaseAsset: *a, id: id}
+	if b, ok := cacheRead(ca); ok {
+		return b, nil
+	}
+
+	rc, err := c.OpenAsset(id, a)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == a.GetSize() {
+		sum := sha256.Sum256(b)
+		if err := cacheStore(ca, hex.EncodeToString(sum[:]), bytes.NewReader(b)); err != nil {
+			log.Printf("warning: cache %s: %s", id, err)
+		}
+	}
+	return b, nil
 }
 
-// download is called by workers for the downer
-// don't call this directly! use d.queue(dir, as)
-func (d *downer) download(dir string, a asset) error {
-	log.Printf("get %s", a.id)
-	rc, rd, err := d.c.Repositories.DownloadReleaseAsset(ctxbg,
-		a.id.org, a.id.repo, a.GetID())
+// AssetSum downloads the release asset a and returns its sha256 checksum.
+func (c *client) AssetSum(id ident, a *github.ReleaseAsset) (string, error) {
+	rc, err := c.OpenAsset(id, a)
 	if err != nil {
-		return fmt.Errorf("download %s: %s", a.id, err)
+		return "", err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return "", err
+	}
+	if n != int64(a.GetSize()) {
+		return "", fmt.Errorf("short read: got %d of %d bytes", n, a.GetSize())
 	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	if rc == nil {
-		rsp, err := http.Get(rd)
-		if err != nil {
-			return fmt.Errorf("download redirect %s: %s", a.id, err)
+// PutSums uploads the checksum manifest ss to the release r, merged with the
+// manifest already in the release, if any. An existing manifest is replaced
+// only if it changes. If key is not nil the manifest is also signed, otherwise
+// the signature of a replaced manifest is deleted as it no longer matches.
+func (c *client) PutSums(id ident, r *github.RepositoryRelease, ss sums, key ed25519.PrivateKey) error {
+	as, err := c.ListAssets(id, r)
+	if err != nil {
+		return err
+	}
+
+	var old, sig *github.ReleaseAsset
+	for i := range as {
+		switch as[i].GetName() {
+		case sumsName:
+			old = &as[i]
+		case sumsName + sigExt:
+			sig = &as[i]
 		}
-		rc = rsp.Body
 	}
-	defer rc.Close()
 
-	w := os.Stdout
-	if dir != "\x00" {
-		f, err := os.Create(filepath.Join(dir, a.id.dst))
+	all := sums{}
+	if old != nil {
+		rs, err := c.GetSums(id, old)
 		if err != nil {
-			return fmt.Errorf("download create %s: %s", a.id, err)
+			return err
 		}
-		defer f.Close()
-		w = f
+		for k, v := range rs {
+			all[k] = v
+		}
+	}
+	changed := old == nil || (key != nil && sig == nil)
+	for k, v := range ss {
+		if all[k] != v {
+			all[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	b := []byte(all.String())
+	if err := c.UploadBytes(id, r, sumsName, b, old); err != nil {
+		return err
+	}
+	if key == nil {
+		if sig != nil {
+			if _, err := c.Repositories.DeleteReleaseAsset(ctxbg, id.org, id.repo, sig.GetID()); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+	return c.UploadBytes(id, r, sumsName+sigExt, sign(key, r.GetTagName(), sumsName, b), sig)
+}
 
-	_, err = io.Copy(w, rc)
+// UploadBytes uploads b as the asset name of release r. If old is not nil it
+// is deleted first, replacing it.
+func (c *client) UploadBytes(id ident, r *github.RepositoryRelease, name string, b []byte, old *github.ReleaseAsset) error {
+	tmp, err := ioutil.TempDir("", "hubr-upload")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	p := filepath.Join(tmp, name)
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+	f, err := os.Open(p)
 	if err != nil {
-		return fmt.Errorf("download copy %s: %s", a.id, err)
+		return err
+	}
+	defer f.Close()
+
+	if old != nil {
+		if _, err := c.Repositories.DeleteReleaseAsset(ctxbg, id.org, id.repo, old.GetID()); err != nil {
+			return fmt.Errorf("replace %s: %s", name, err)
+		}
 	}
+	_, _, err = c.Repositories.UploadReleaseAsset(ctxbg, id.org, id.repo, r.GetID(),
+		&github.UploadOptions{Name: name}, f)
 	return err
 }
 
-// upper performs uploaads using parallel workers. Call queue(dst, src) to append
-// an upload job. Call wait() to wait on the workers and collect any errors.
+// paginate calls list for each page of a GitHub list endpoint, following the
+// next page link of each response. Paging stops when there are no more pages,
+// when list returns false or an error, or when pageLimit pages have been read.
+func paginate(list func(*github.ListOptions) (*github.Response, bool, error)) error {
+	opt := &github.ListOptions{PerPage: perPage}
+	for n := 1; ; n++ {
+		rsp, more, err := list(opt)
+		if err != nil {
+			return err
+		}
+		if !more || rsp == nil || rsp.NextPage == 0 {
+			return nil
+		}
+		if pageLimit > 0 && n >= pageLimit {
+			log.Printf("warning: stopped listing after %d pages, see HUBR_PAGE_LIMIT", n)
+			return nil
+		}
+		opt.Page = rsp.NextPage
+	}
+}
+
+// downer performs downloaads using parallel workers. Call queue(dir, as) to
+// append a slice of assets to download, such as returned by client.GlobAssets.
+// Call wait() to wait on the workers and collect any errors.
 // Attempting to queue after a wait will cause a panic.
-type upper struct {
+type downer struct {
 	c     *client
-	r     *github.RepositoryRelease
-	id    ident
-	queue func(string, string)
+	keys  []ed25519.PublicKey
+	queue func(string, []asset)
 	wait  func() []error
+	sums  func(asset) (sums, error)
 }
 
-// newUpper creates a new upper for a release using a client and a number of
-// parallel workers. Calling newUpper starts the worker pool.
-func newUpper(c *client, wkrs int, id ident, r *github.RepositoryRelease) upper {
-	type ul struct {
-		dst string
-		src string
+// newDowner creates a new downer using a client and a number of
+// parallel workers. Calling newDowner starts the worker pool. If any trusted
+// keys are given, every download must have a valid signature by one of them.
+func newDowner(c *client, wkrs int, keys []ed25519.PublicKey) downer {
+	type dl struct {
+		dir string
+		a   asset
 	}
 
-	ulc := make(chan ul)
+	dlc := make(chan dl)
 	done := make(chan struct{})
 	errs, eall := erraggr()
 
-	u := upper{
-		c:  c,
-		r:  r,
-		id: id,
-		queue: func(dst, src string) {
-			ulc <- ul{dst, src}
+	// checksum manifests are fetched once per release
+	var mu sync.Mutex
+	sss := map[int64]sums{}
+
+	d := downer{
+		c:    c,
+		keys: keys,
+		sums: func(a asset) (sums, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if ss, ok := sss[a.sums.GetID()]; ok {
+				return ss, nil
+			}
+			ss, err := c.GetSums(a.id, a.sums)
+			if err != nil {
+				return nil, err
+			}
+			sss[a.sums.GetID()] = ss
+			return ss, nil
+		},
+		queue: func(dir string, as []asset) {
+			for _, a := range as {
+				dlc <- dl{dir, a}
+			}
 		},
 		wait: func() []error {
-			close(ulc)
+			close(dlc)
 			for i := 0; i < wkrs; i++ {
 				<-done
 			}
@@ -505,1763 +1275,6168 @@ func newUpper(c *client, wkrs int, id ident, r *github.RepositoryRelease) upper
 
 	for i := 0; i < wkrs; i++ {
 		go func() {
-			for v := range ulc {
-				errs <- u.upload(v.dst, v.src)
+			for v := range dlc {
+				errs <- d.download(v.dir, v.a)
 			}
 			done <- struct{}{}
 		}()
 	}
 
-	return u
+	return d
 }
 
-// upload is called by workers for the upper
-// don't call this directly! use u.queue(dst, src)
-func (u *upper) upload(dst string, src string) error {
-	f, err := os.Open(src)
+// download is called by workers for the downer
+// don't call this directly! use d.queue(dir, as)
+// If the release has a checksum manifest the download is verified against it.
+// If the downer has trusted keys the signature of the download is verified.
+// The download is written to a partial file and only moved to the
+// destination, or copied to stdout, once it is verified. A partial file left
+// by a failed transfer is resumed with a ranged request on the next attempt.
+// Verified downloads are kept in the download cache, and an asset found in
+// the cache is copied from it rather than downloaded.
+func (d *downer) download(dir string, a asset) error {
+	log.Printf("get %s", a.id)
+
+	var want string
+	if a.sums != nil && a.GetName() != sumsName && !strings.HasSuffix(a.GetName(), sigExt) {
+		ss, err := d.sums(a)
+		if err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+		want = ss[a.GetName()]
+		if want == "" {
+			log.Printf("warning: %s is not listed in %s", a.id, sumsName)
+		}
+	}
+
+	// signatures are not themselves signed
+	keys := d.keys
+	if strings.HasSuffix(a.GetName(), sigExt) {
+		keys = nil
+	}
+
+	var sig []byte
+	if len(keys) > 0 {
+		if a.sig == nil {
+			return fmt.Errorf("download %s: no signature %s", a.id, a.GetName()+sigExt)
+		}
+		b, err := d.c.ReadAsset(a.id, a.sig)
+		if err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+		sig = b
+	}
+
+	tdir := dir
+	if dir == "\x00" {
+		tdir = os.TempDir()
+	}
+
+	// a partial file left by an interrupted download is resumed, except when
+	// writing to stdout. It is named by the asset id, size and update time so
+	// the partial of another release or of a replaced asset is never resumed.
+	part := filepath.Join(tdir, fmt.Sprintf(".%s.%d-%d-%d.hubr-part",
+		a.id.dst, a.GetID(), a.GetSize(), a.GetUpdatedAt().Unix()))
+	tmp, err := ioutil.TempFile(tdir, "."+a.id.dst+".hubr-")
 	if err != nil {
-		return err
+		return fmt.Errorf("download create %s: %s", a.id, err)
 	}
-	defer f.Close()
-	st, err := f.Stat()
+	tmp.Close()
+	work := tmp.Name()
+	if dir != "\x00" {
+		// the partial file is claimed by renaming it over a new temporary file,
+		// so concurrent downloads never write to the same file
+		os.Rename(part, work)
+	}
+	f, err := os.OpenFile(work, os.O_RDWR, 0600)
+	if err != nil {
+		os.Remove(work)
+		return fmt.Errorf("download create %s: %s", a.id, err)
+	}
+	keep := false
+	defer func() {
+		f.Close()
+		if keep && dir != "\x00" && os.Rename(work, part) == nil {
+			return
+		}
+		os.Remove(work)
+	}()
+
+	// an asset in the download cache replaces any partial file
+	size := int64(a.GetSize())
+	cached := cacheCopy(a, want, f)
+	if cached {
+		log.Printf("cached %s", a.id)
+	}
+
+	off, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
+		return fmt.Errorf("download %s: %s", a.id, err)
+	}
+	if off > size {
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+		if off, err = f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+	}
+
+	h := sha256.New()
+	if off > 0 {
+		if !cached {
+			log.Printf("resume %s at %d of %d bytes", a.id, off, size)
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(f, 0, off)); err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+	}
+
+	// a dropped connection, or a body which ends early, resumes from the bytes
+	// already written
+	t := prog.start(a.GetName(), size, off)
+	defer t.done()
+	for n := 1; off < size || size == 0; n++ {
+		rc, err := d.c.OpenAssetAt(a.id, &a.ReleaseAsset, off)
+		if err != nil {
+			keep = true
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+		w, err := io.Copy(io.MultiWriter(f, h, t), rc)
+		rc.Close()
+		off += w
+		if err == nil && (size == 0 || off >= size) {
+			break
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if n >= retries {
+			keep = true
+			return fmt.Errorf("download copy %s: %s", a.id, err)
+		}
+		log.Printf("resume %s at %d of %d bytes: %s", a.id, off, size, err)
+	}
+	if size > 0 && off != size {
+		return fmt.Errorf("download %s: size mismatch: got %d of %d bytes", a.id, off, size)
+	}
+	if err := checkSum(a.id, want, h); err != nil {
 		return err
 	}
+	if len(keys) > 0 {
+		if err := verify(keys, a.id.tag, a.GetName(), h.Sum(nil), sig); err != nil {
+			return fmt.Errorf("download %s: %s", a.id, err)
+		}
+	}
+	if !cached {
+		if err := cacheStore(a, hex.EncodeToString(h.Sum(nil)), f); err != nil {
+			log.Printf("warning: cache %s: %s", a.id, err)
+		}
+	}
 
-	for _, a := range u.r.Assets {
-		if dst != a.GetName() {
-			continue
+	if dir == "\x00" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("download copy %s: %s", a.id, err)
 		}
-		if st.Size() != int64(a.GetSize()) {
-			return errors.New("release asset " + u.id.tag + " " + dst + " exists and is a different size to " + src)
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return fmt.Errorf("download copy %s: %s", a.id, err)
 		}
 		return nil
 	}
 
-	_, _, err = u.c.Repositories.UploadReleaseAsset(ctxbg,
-		u.id.org, u.id.repo, u.r.GetID(),
-		&github.UploadOptions{Name: dst}, f)
-	return err
+	if err := commitFile(f, filepath.Join(dir, a.id.dst), 0644); err != nil {
+		return fmt.Errorf("download %s: %s", a.id, err)
+	}
+	return nil
 }
 
-type errNotFound struct {
-	ident
+// defaultCacheDir returns the hubr directory of the user cache directory, or
+// an empty string if there is none.
+func defaultCacheDir() string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, "hubr")
 }
 
-func isNotFound(err error) bool {
-	_, ok := err.(errNotFound)
-	return ok
+// parseSize parses a number of bytes with an optional K, M, G or T binary
+// unit suffix.
+func parseSize(s string) (int64, error) {
+	t := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	t = strings.TrimSuffix(t, "I")
+	m := int64(1)
+	if i := strings.IndexAny(t, "KMGT"); i >= 0 && i == len(t)-1 {
+		m = 1 << (10 * uint(strings.IndexByte("KMGT", t[i])+1))
+		t = t[:i]
+	}
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a size: %s", s)
+	}
+	return n * m, nil
 }
 
-func (e errNotFound) Error() string {
-	return fmt.Sprintf("%s was not found", e.ident.String())
+// cacheEntry describes an asset in the download cache. The contents are
+// stored once by checksum under blobs, and each asset has an entry under
+// keys named by its id, size and update time, so that a replaced asset is
+// never served from the cache. Cached api responses, see cacher, are listed
+// as entries of kind api with the url as the asset.
+type cacheEntry struct {
+	Kind    string    `json:"kind,omitempty"`
+	Asset   string    `json:"asset"`
+	ID      int64     `json:"id"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+	SHA256  string    `json:"sha256"`
+	Used    time.Time `json:"used"`
 }
 
-type errNoReleases struct {
-	ident
+// newCacheEntry returns the cache entry of a with the checksum sum.
+func newCacheEntry(a asset, sum string) cacheEntry {
+	return cacheEntry{
+		Asset:   a.id.String(),
+		ID:      a.GetID(),
+		Size:    int64(a.GetSize()),
+		Updated: a.GetUpdatedAt().Time,
+		SHA256:  sum,
+	}
 }
 
-func isNoReleases(err error) bool {
-	_, ok := err.(errNoReleases)
-	return ok
+// key returns the path of the cache entry.
+func (e cacheEntry) key() string {
+	k := fmt.Sprintf("%d-%d-%d.json", e.ID, e.Size, e.Updated.Unix())
+	return filepath.Join(cacheDir, "keys", k)
 }
 
-func (e errNoReleases) Error() string {
-	return fmt.Sprintf("%s has no releases", e.ident.String())
+// cacheBlob returns the path of the cached contents with the checksum sum.
+func cacheBlob(sum string) string {
+	return filepath.Join(cacheDir, "blobs", sum)
 }
 
-// regexp pattern for ident
-const (
-	idSlugPart = `(?:([\d\w_-]+)/)?`
-	idRepoPart = `([\d\w_-]+)`
-	idTagPart  = `(?:@([\d\w\._-]+))?`
-	idGlobPart = `(?::([\d\w\.\*\?\[\]\^_-]+))?`
-	idFilePart = `(?::([\d\w\._-]+))?`
-	idRe       = "^" + idSlugPart + idRepoPart + idTagPart + idGlobPart + idFilePart + "$"
-)
-
-// regexp for ident
-var (
-	idRx     = regexp.MustCompile(idRe)
-	noGlobRx = regexp.MustCompile(`^[\d\w\._-]+$`)
-)
+// cacheCopy replaces the contents of f with the asset a from the download
+// cache, found by its checksum sum if known or its cache entry. It reports
+// whether the asset was in the cache. Contents which no longer match their
+// checksum are removed from the cache, leaving f as it was.
+func cacheCopy(a asset, sum string, f *os.File) bool {
+	if sum = cacheSum(a, sum); sum == "" {
+		return false
+	}
 
-// ident can identify a repo, tag, or asset and destination name.
-type ident struct {
-	org, repo, tag, asset, dst string
-}
+	p := cacheBlob(sum)
+	bf, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer bf.Close()
 
-func parseID(s string) (ident, bool) {
-	ms := idRx.FindStringSubmatch(s)
-	if len(ms) != 6 {
-		return ident{}, false
+	// the blob is checked before the partial file is replaced, so that a
+	// corrupt blob never costs a partial download
+	h := sha256.New()
+	n, err := io.Copy(h, bf)
+	if err != nil {
+		return false
 	}
-	id := ident{ms[1], ms[2], ms[3], ms[4], ms[5]}
-	if id.org == "" {
-		id.org = defaultOrg
+	if n != int64(a.GetSize()) || hex.EncodeToString(h.Sum(nil)) != sum {
+		os.Remove(p)
+		return false
 	}
-	if id.org == "" {
-		log.Printf("%s has no org and HUBR_DEFAULT_ORG is not set", s)
-		return ident{}, false
+
+	if _, err := bf.Seek(0, io.SeekStart); err != nil {
+		return false
 	}
-	if id.tag == "" {
-		id.tag = defaultTag
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false
 	}
-	glob := !noGlobRx.MatchString(id.asset)
-	switch {
-	case glob && id.dst != "":
-		return ident{}, false
-	case !glob && id.dst == "":
-		id.dst = id.asset
+	if err := f.Truncate(0); err != nil {
+		return false
+	}
+	// whatever is copied is a prefix of the asset, so a failed copy leaves
+	// a partial file to resume
+	if _, err := io.Copy(f, bf); err != nil {
+		return false
 	}
 
-	return id, true
+	// the modification time of the contents is the time they were last used
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return true
 }
 
-func (id ident) String() string {
-	s := id.org + "/" + id.repo
-	if id.tag != defaultTag {
-		s += "@" + id.tag
+// cacheRead returns the contents of the asset a from the download cache, and
+// whether it was in the cache.
+func cacheRead(a asset) ([]byte, bool) {
+	sum := cacheSum(a, "")
+	if sum == "" {
+		return nil, false
 	}
-	if id.asset != "" {
-		s += ":" + id.asset
+	p := cacheBlob(sum)
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, false
 	}
-	if id.dst != id.asset && id.dst != "" {
-		s += ":" + id.dst
+	if h := sha256.Sum256(b); len(b) != a.GetSize() || hex.EncodeToString(h[:]) != sum {
+		os.Remove(p)
+		return nil, false
 	}
-	return s
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return b, true
 }
 
-// increment is a semver increment
-type increment int
-
-const (
-	noinc increment = iota
-	major
-	minor
-	patch
-	allinc
-)
-
-// parseIncrement converts a string to an increment.
-func parseIncrement(s string) (increment, error) {
-	i := map[string]increment{
-		"major": major, "minor": minor, "patch": patch,
-	}[s]
-	if i == noinc {
-		return i, errors.New("not an increment: " + s)
+// cacheSum returns sum, or if it is empty the checksum of the asset a from
+// its cache entry. It returns an empty string if the cache is disabled or
+// the asset is not cached.
+func cacheSum(a asset, sum string) string {
+	if cacheDir == "" || a.GetSize() == 0 {
+		return ""
 	}
-	return i, nil
+	if sum != "" {
+		return sum
+	}
+	b, err := ioutil.ReadFile(newCacheEntry(a, "").key())
+	if err != nil {
+		return ""
+	}
+	var e cacheEntry
+	if json.Unmarshal(b, &e) != nil {
+		return ""
+	}
+	return e.SHA256
 }
 
-// String returns a string representation of the increment.
-func (i increment) String() string {
-	return map[increment]string{
-		noinc: "invalid", major: "major", minor: "minor", patch: "patch",
-	}[i]
-}
+// cacheStore adds the verified download of a in r, with the checksum sum, to
+// the download cache, then evicts the least recently used contents until the
+// cache is no larger than cacheMax.
+func cacheStore(a asset, sum string, r io.ReaderAt) error {
+	if cacheDir == "" || a.GetSize() == 0 {
+		return nil
+	}
+	for _, d := range []string{"blobs", "keys"} {
+		if err := os.MkdirAll(filepath.Join(cacheDir, d), 0755); err != nil {
+			return err
+		}
+	}
 
-// spec is a set of parameters to create or update a release.
-type spec struct {
-	id                ident
-	draft, pre, keepd bool
-	sha, name, body   string
-	uploads           []string
-	wkrs              int
-}
+	p := cacheBlob(sum)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		bf, err := ioutil.TempFile(filepath.Dir(p), ".hubr-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(bf.Name())
+		defer bf.Close()
+		if _, err := io.Copy(bf, io.NewSectionReader(r, 0, int64(a.GetSize()))); err != nil {
+			return err
+		}
+		if err := commitFile(bf, p, 0644); err != nil {
+			return err
+		}
+	}
 
-// release does exactly what it says. A tag is created if one does not
-// exist. A release is created if one does not exist. Files listed in uploads
-// are uploaded.
-func (s spec) release() error {
-	c, err := newClient()
+	e := newCacheEntry(a, sum)
+	b, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
-
-	err = c.CreateTag(s.id, s.sha, "release "+s.name)
+	kf, err := ioutil.TempFile(filepath.Join(cacheDir, "keys"), ".hubr-")
 	if err != nil {
-		return fmt.Errorf("tag: %s", err)
+		return err
+	}
+	defer os.Remove(kf.Name())
+	defer kf.Close()
+	if _, err := kf.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := commitFile(kf, e.key(), 0644); err != nil {
+		return err
 	}
 
-	r, err := c.DraftRelease(s.id, s.name, s.body, s.pre)
+	return cacheEvict(cacheMax)
+}
+
+// cacheEntries lists the entries of the download cache, least recently used
+// first. Entries whose contents are missing are removed.
+func cacheEntries() ([]cacheEntry, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(cacheDir, "keys"))
+	if os.IsNotExist(err) {
+		return []cacheEntry{}, nil
+	}
 	if err != nil {
-		return fmt.Errorf("draft release: %s", err)
+		return nil, err
 	}
 
-	if len(s.uploads) > 0 {
-		u := newUpper(c, s.wkrs, s.id, r)
-		for _, src := range s.uploads {
-			dst := src
-			if !s.keepd {
-				dst = filepath.Base(src)
-			}
-			u.queue(dst, src)
-			log.Print("uploading ", src)
+	es := []cacheEntry{}
+	for _, fi := range fis {
+		k := filepath.Join(cacheDir, "keys", fi.Name())
+		if !strings.HasSuffix(fi.Name(), ".json") {
+			continue
 		}
-		errs := u.wait()
-		if len(errs) > 0 {
-			for _, err := range errs {
-				log.Print(err)
-			}
-			return errors.New("uploads failed")
+		b, err := ioutil.ReadFile(k)
+		if err != nil {
+			return nil, err
+		}
+		var e cacheEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			os.Remove(k)
+			continue
+		}
+		bi, err := os.Stat(cacheBlob(e.SHA256))
+		if err != nil {
+			os.Remove(k)
+			continue
 		}
+		e.Kind = "asset"
+		e.Used = bi.ModTime()
+		es = append(es, e)
 	}
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Used.Before(es[j].Used) })
+	return es, nil
+}
 
-	if s.draft {
-		log.Print(s.id.repo, " ", s.id.tag, " draft release updated")
-		return nil
+// cacheHTTPEntries lists the api responses in the download cache, least
+// recently used first.
+func cacheHTTPEntries() ([]cacheEntry, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(cacheDir, "http"))
+	if os.IsNotExist(err) {
+		return []cacheEntry{}, nil
 	}
-
-	err = c.PublishRelease(s.id)
 	if err != nil {
-		return fmt.Errorf("publish release: %s", err)
+		return nil, err
 	}
 
-	octolog(c, s.id.String()+" released!")
-	return nil
-}
-
-// versionRe matches a semver of the form 0.0.0 with any prefix or suffix.
-var versionRe = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
-
-// version is a semver version of the form 0.0.0 with any prefix or suffix
-type version string
-
-// parseVersion converts a string into a version. It returns an error if s does
-// not match the version regexp.
-func parseVersion(s string) (version, error) {
-	if !versionRe.MatchString(s) {
-		return version(""), errors.New("version does not match 0.0.0 pattern")
+	es := []cacheEntry{}
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(cacheDir, "http", fi.Name()))
+		if err != nil {
+			continue
+		}
+		var h httpEntry
+		if json.Unmarshal(b, &h) != nil {
+			continue
+		}
+		es = append(es, cacheEntry{Kind: "api", Asset: h.URL, Size: fi.Size(), Used: fi.ModTime()})
 	}
-	return version(s), nil
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Used.Before(es[j].Used) })
+	return es, nil
 }
 
-// bump returns a new version incremented as instructed.
-func (v version) bump(incr increment) version {
-	now := string(v)
-
-	ms := versionRe.FindStringSubmatch(now)
-	if len(ms) != 4 {
-		now = "v0.0.0"
-		ms = []string{"0.0.0", "0", "0", "0"}
+// cacheEvict removes the least recently used contents of the download cache,
+// and their entries, until it is no larger than max bytes. Asset contents and
+// api responses count towards the same max. Contents without an entry are
+// removed too. A max of zero is unlimited.
+func cacheEvict(max int64) error {
+	es, err := cacheEntries()
+	if err != nil {
+		return err
 	}
-
-	i, _ := strconv.Atoi(ms[incr])
-	i++
-	ms[incr] = strconv.Itoa(i)
-	for i := incr + 1; i < allinc; i++ {
-		ms[i] = "0"
+	keys := map[string][]cacheEntry{}
+	for _, e := range es {
+		keys[e.SHA256] = append(keys[e.SHA256], e)
 	}
-	next := ms[major] + "." + ms[minor] + "." + ms[patch]
-
-	l := versionRe.FindStringIndex(now)
-	return version(now[:l[0]] + next + now[l[1]:])
-}
 
-// isBefore returns true if v is an earlier version than u. Any prefixes or
-// suffixes are ignored.
-func (v version) isBefore(u version) bool {
-	vs := versionRe.FindStringSubmatch(string(v))
-	if len(vs) != 4 {
-		vs = []string{"0.0.0", "0", "0", "0"}
+	// the contents are the blobs, used while they have an entry, and the api
+	// responses, which are their own entry
+	type content struct {
+		os.FileInfo
+		dir  string
+		keys []cacheEntry
+		used bool
 	}
-	us := versionRe.FindStringSubmatch(string(u))
-	if len(us) != 4 {
-		us = []string{"0.0.0", "0", "0", "0"}
+	var cs []content
+	var total int64
+	for _, d := range []string{"blobs", "http"} {
+		fis, err := ioutil.ReadDir(filepath.Join(cacheDir, d))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			c := content{FileInfo: fi, dir: d, used: d == "http"}
+			if d == "blobs" {
+				c.keys = keys[fi.Name()]
+				c.used = len(c.keys) > 0
+			}
+			cs = append(cs, c)
+			total += fi.Size()
+		}
 	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ModTime().Before(cs[j].ModTime()) })
 
-	for i := major; i < allinc; i++ {
-		v, _ := strconv.Atoi(vs[i])
-		u, _ := strconv.Atoi(us[i])
-		if v > u {
-			return false
+	for _, c := range cs {
+		if (max == 0 || total <= max) && (c.used || time.Since(c.ModTime()) < time.Minute) {
+			// contents without an entry may be being stored
+			continue
 		}
-		if v < u {
-			return true
+		for _, e := range c.keys {
+			os.Remove(e.key())
+		}
+		if err := os.Remove(filepath.Join(cacheDir, c.dir, c.Name())); err != nil && !os.IsNotExist(err) {
+			return err
 		}
+		total -= c.Size()
 	}
-	return false
+	return nil
 }
 
-// String returns the version string or v0.0.0 if the string is empty.
-func (v version) String() string {
-	if v == "" {
-		return "v0.0.0"
-	}
-	return strings.TrimRight(string(v), "\n")
+// upper performs uploaads using parallel workers. Call queue(dst, src) to append
+// an upload job. Call wait() to wait on the workers and collect any errors.
+// Attempting to queue after a wait will cause a panic.
+type upper struct {
+	c     *client
+	r     *github.RepositoryRelease
+	id    ident
+	as    []github.ReleaseAsset
+	sums  sums
+	key   ed25519.PrivateKey
+	queue func(string, string)
+	wait  func() []error
 }
 
-// versioner sifts through a local git repo for version information.
-type versioner struct {
-	*git.Repository
-	path string
-}
+// newUpper creates a new upper for a release using a client and a number of
+// parallel workers. Calling newUpper starts the worker pool. The existing
+// assets and checksum manifest of the release are fetched first. If key is not
+// nil, a detached signature is uploaded for each upload.
+func newUpper(c *client, wkrs int, id ident, r *github.RepositoryRelease, key ed25519.PrivateKey) (upper, error) {
+	type ul struct {
+		dst string
+		src string
+	}
 
-// newVersioner returns a versioner for a local git repo using the given file
-// path of the VERSION file in the repository. The working directory must be
-// inside a git repository.
-func newVersioner(path string) (versioner, error) {
-	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	as, err := c.ListAssets(id, r)
 	if err != nil {
-		return versioner{}, err
+		return upper{}, fmt.Errorf("list assets: %s", err)
+	}
+	ss := sums{}
+	for i := range as {
+		if as[i].GetName() != sumsName {
+			continue
+		}
+		ss, err = c.GetSums(id, &as[i])
+		if err != nil {
+			return upper{}, err
+		}
 	}
-	return versioner{r, path}, nil
-}
 
-// head returns the value of the VERSION file at HEAD.
-func (vr versioner) head() (version, error) {
-	var v version
+	ulc := make(chan ul)
+	done := make(chan struct{})
+	errs, eall := erraggr()
 
-	head, err := vr.Head()
-	if err != nil {
-		return v, err
+	u := upper{
+		c:    c,
+		r:    r,
+		id:   id,
+		as:   as,
+		sums: ss,
+		key:  key,
+		queue: func(dst, src string) {
+			ulc <- ul{dst, src}
+		},
+		wait: func() []error {
+			close(ulc)
+			for i := 0; i < wkrs; i++ {
+				<-done
+			}
+			return <-eall
+		},
 	}
 
-	c, err := vr.CommitObject(head.Hash())
-	if err != nil {
-		return v, err
+	for i := 0; i < wkrs; i++ {
+		go func() {
+			for v := range ulc {
+				errs <- u.upload(v.dst, v.src)
+			}
+			done <- struct{}{}
+		}()
 	}
 
-	return vr.at(c)
+	return u, nil
 }
 
-// at returns the value of the VERSION file at c.
-func (vr versioner) at(c *object.Commit) (version, error) {
-	var v version
-
-	t, err := c.Tree()
-	if err != nil {
-		return v, err
+// upload is called by workers for the upper
+// don't call this directly! use u.queue(dst, src)
+func (u *upper) upload(dst string, src string) error {
+	if err := u.uploadFile(dst, src); err != nil {
+		return err
 	}
-
-	f, err := t.File(vr.path)
-	if err == object.ErrFileNotFound {
-		return v, nil
+	if u.key == nil || strings.HasSuffix(dst, sigExt) {
+		return nil
 	}
-	if err != nil {
-		return v, err
+	for _, a := range u.as {
+		if a.GetName() == dst+sigExt {
+			return nil
+		}
 	}
-
-	s, err := f.Contents()
+	sig, err := signFile(u.key, u.r.GetTagName(), dst, src)
 	if err != nil {
-		return v, err
+		return fmt.Errorf("sign %s: %s", src, err)
 	}
-
-	l := strings.SplitN(s, "\n", 2)
-	return parseVersion(l[0])
+	return u.c.UploadBytes(u.id, u.r, dst+sigExt, sig, nil)
 }
 
-// logDiff returns the additions made to the version file in the last commit.
-func (vr versioner) logDiff() ([]string, error) {
-	h, err := vr.Head()
+// uploadFile uploads the file src as the asset dst if it does not exist.
+func (u *upper) uploadFile(dst string, src string) error {
+	f, err := os.Open(src)
 	if err != nil {
-		return []string{}, err
+		return err
 	}
-	hc, err := vr.CommitObject(h.Hash())
+	defer f.Close()
+	st, err := f.Stat()
 	if err != nil {
-		return []string{}, err
+		return err
 	}
 
-	switch hc.NumParents() {
-	case 0:
-		return []string{}, nil
-	case 1:
-	default:
-		return []string{}, errors.New("head is a merge commit; merge commits cannot be releases")
+	for _, a := range u.as {
+		if dst != a.GetName() {
+			continue
+		}
+		if st.Size() != int64(a.GetSize()) {
+			return errors.New("release asset " + u.id.tag + " " + dst + " exists and is a different size to " + src)
+		}
+		want := u.sums[dst]
+		if want == "" {
+			// the asset is hashed so a file of the same size is not taken for
+			// it, and a manifest of the uploads describes the release
+			if want, err = u.c.AssetSum(u.id, &a); err != nil {
+				return fmt.Errorf("checksum release asset %s: %s", dst, err)
+			}
+		}
+		got, err := fileSum(src)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return errors.New("release asset " + u.id.tag + " " + dst + " exists and has a different checksum to " + src)
+		}
+		return nil
 	}
 
-	ht, err := hc.Tree()
+	t := prog.start(dst, st.Size(), 0)
+	defer t.done()
+
+	// the request is made here rather than by UploadReleaseAsset so the body
+	// can be metered
+	p := fmt.Sprintf("repos/%s/%s/releases/%d/assets?name=%s",
+		u.id.org, u.id.repo, u.r.GetID(), url.QueryEscape(dst))
+	req, err := u.c.NewUploadRequest(p, io.TeeReader(f, t), st.Size(),
+		mime.TypeByExtension(filepath.Ext(src)))
 	if err != nil {
-		return []string{}, err
+		return err
 	}
+	_, err = u.c.Do(ctxbg, req, new(github.ReleaseAsset))
+	return err
+}
 
-	pc, err := hc.Parent(0)
-	if err != nil {
-		return []string{}, err
+// cacher is an http.RoundTripper which keeps github api responses with an
+// ETag in the http directory of the download cache. A cached response is
+// revalidated with a conditional request, and returned if it is not
+// modified, which does not count against the rate limit. When offline every
+// request is answered from the cache, or fails if it is not cached. Asset
+// downloads are not cached here, see cacheStore. The cache is evicted once
+// the command is done if any response was saved, see cacheEvictSaved.
+type cacher struct {
+	next http.RoundTripper
+}
+
+// httpSaved is set once a response is saved in the cache.
+var httpSaved int32
+
+// cacheEvictSaved evicts the download cache if the cacher saved any responses.
+func cacheEvictSaved() {
+	if atomic.LoadInt32(&httpSaved) == 0 {
+		return
 	}
+	if err := cacheEvict(cacheMax); err != nil {
+		log.Printf("warning: cache evict: %s", err)
+	}
+}
 
-	pt, err := pc.Tree()
+// httpEntry is a cached response.
+type httpEntry struct {
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// errOffline is the error of a request which is not in the cache when offline.
+type errOffline struct {
+	req *http.Request
+}
+
+func (e errOffline) Error() string {
+	if e.req.Method != http.MethodGet {
+		return "offline: " + e.req.Method + " is not allowed"
+	}
+	return "offline: not cached, run once online to fill the cache"
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t cacher) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cacheDir == "" || req.Method != http.MethodGet || strings.Contains(req.Header.Get("Accept"), "octet-stream") {
+		if offline {
+			return nil, errOffline{req}
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	k := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	p := filepath.Join(cacheDir, "http", hex.EncodeToString(k[:])+".json")
+	var e httpEntry
+	b, err := ioutil.ReadFile(p)
+	cached := err == nil && json.Unmarshal(b, &e) == nil && e.URL == req.URL.String()
+	if offline {
+		if !cached {
+			return nil, errOffline{req}
+		}
+		e.touch(p)
+		return e.response(req), nil
+	}
+
+	if cached && req.Header.Get("If-None-Match") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", e.Header.Get("Etag"))
+	}
+	rsp, err := t.next.RoundTrip(req)
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 
-	ss := []string{}
-	chs, err := pt.Diff(ht)
-	for _, ch := range chs {
-		p, err := ch.Patch()
+	switch {
+	case cached && rsp.StatusCode == http.StatusNotModified:
+		io.Copy(ioutil.Discard, rsp.Body)
+		rsp.Body.Close()
+		for h, v := range rsp.Header {
+			if strings.HasPrefix(h, "X-Ratelimit-") {
+				e.Header[h] = v
+			}
+		}
+		e.touch(p)
+		return e.response(req), nil
+	case rsp.StatusCode == http.StatusOK && rsp.Header.Get("Etag") != "" &&
+		strings.Contains(rsp.Header.Get("Content-Type"), "json"):
+		b, err := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
 		if err != nil {
-			return []string{}, err
+			return nil, err
 		}
-		for _, fp := range p.FilePatches() {
-			if fp.IsBinary() {
-				continue
-			}
-			if _, to := fp.Files(); to.Path() != vr.path {
-				continue
-			}
-			for _, c := range fp.Chunks() {
-				if c.Type() == diff.Add {
-					ss = append(ss, c.Content())
-				}
-			}
+		rsp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		e := httpEntry{req.URL.String(), rsp.Header, b}
+		if err := e.save(p); err != nil {
+			log.Printf("warning: cache %s: %s", req.URL, err)
+		} else {
+			atomic.StoreInt32(&httpSaved, 1)
 		}
 	}
-	return ss, nil
+	return rsp, nil
 }
 
-// files returns a map of files and directories that have changed since the
-// last release.
-func (vr versioner) files() (map[string]bool, error) {
-	fs := map[string]bool{}
+// response returns the cached response as a response to req.
+func (e httpEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
 
-	h, err := vr.Head()
-	if err != nil {
-		return fs, fmt.Errorf("head: %s", err)
+// touch marks the cached response in the file p as used now, for eviction.
+func (e httpEntry) touch(p string) {
+	now := time.Now()
+	os.Chtimes(p, now, now)
+}
+
+// save writes the cached response to the file p.
+func (e httpEntry) save(p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
 	}
-	hc, err := vr.CommitObject(h.Hash())
+	b, err := json.Marshal(e)
 	if err != nil {
-		return fs, fmt.Errorf("head commit: %s", err)
+		return err
 	}
-
-	ok, err := vr.isRelease()
+	f, err := ioutil.TempFile(filepath.Dir(p), ".hubr-")
 	if err != nil {
-		return fs, fmt.Errorf("head is release: %s", err)
-	}
-
-	var vbase version
-	switch ok {
-	case true:
-		pc, err := hc.Parent(0)
-		if err != nil {
-			return fs, fmt.Errorf("head commit: %s", err)
-		}
-		vbase, err = vr.at(pc)
-	default:
-		vbase, err = vr.at(hc)
+		return err
 	}
-	if err != nil {
-		return fs, fmt.Errorf("base version: %s", err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return err
 	}
+	return commitFile(f, p, 0600)
+}
 
-	snd, rcv := passCommits()
-	snd <- hc
+// retrier is an http.RoundTripper which retries requests that fail with a
+// transient error: a network error, a 429, a 5xx, or a 403 caused by a primary
+// or secondary rate limit. Requests are attempted up to the global retries
+// times. The wait between attempts respects the Retry-After and
+// X-RateLimit-Reset headers, otherwise it is an exponential backoff with
+// jitter. Requests with a body that cannot be rewound are not retried, and
+// requests which are not idempotent, such as uploads, are only retried after
+// a rate limit, which the server rejected without processing.
+type retrier struct {
+	next http.RoundTripper
+}
 
-	var cmt *object.Commit
-	for c := range rcv {
-		switch {
-		case c == nil:
-			continue
-		case c.NumParents() == 0:
-		case c.NumParents() == 1:
-			v, err := vr.at(c)
-			if err != nil {
-				return fs, fmt.Errorf("version of %s: %s", c.Hash.String(), err)
-			}
-			if v.isBefore(vbase) {
-				continue
-			}
-			p, err := c.Parent(0)
-			if err != nil {
-				return fs, fmt.Errorf("parent of %s: %s", c.Hash.String(), err)
-			}
-			snd <- p
-		default:
-			err := c.Parents().ForEach(func(c *object.Commit) error {
-				v, err := vr.at(c)
+// the bounds of the wait between attempts of a request
+const (
+	retryBase = time.Second
+	retryCap  = 30 * time.Second
+	retryMax  = 5 * time.Minute
+
+	// github asks for a minute between requests after a secondary rate limit
+	secondaryWait = time.Minute
+)
+
+// RoundTrip implements http.RoundTripper.
+func (t retrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	for n := 1; ; n++ {
+		// a RoundTripper must not modify the request, so each retry is a clone
+		// with a fresh body
+		r := req
+		if n > 1 {
+			r = req.Clone(req.Context())
+			if req.Body != nil {
+				b, err := req.GetBody()
 				if err != nil {
-					return err
-				}
-				if v.isBefore(vbase) {
-					return nil
+					return nil, err
 				}
-				snd <- c
-				return nil
-			})
-			if err != nil {
-				return fs, fmt.Errorf("merge %s: %s", c.Hash.String(), err)
+				r.Body = b
 			}
 		}
-		cmt = c
+
+		rsp, err := t.next.RoundTrip(r)
+		if n >= retries || (req.Body != nil && req.GetBody == nil) {
+			return rsp, err
+		}
+
+		wait, ok := retryAfter(req, rsp, err, n)
+		if !ok || wait > retryMax {
+			return rsp, err
+		}
+		if err != nil {
+			log.Printf("retry %s %s in %s: %s", req.Method, req.URL.Host, wait.Round(time.Second), err)
+		} else {
+			log.Printf("retry %s %s in %s: %s", req.Method, req.URL.Host, wait.Round(time.Second), rsp.Status)
+			io.Copy(ioutil.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
 	}
+}
 
-	if cmt == nil {
-		return fs, fmt.Errorf("cant get commits. missing VERSION?")
+// retryAfter decides if the request req should be retried after the response
+// rsp or the error err on attempt n, and how long to wait before doing so.
+func retryAfter(req *http.Request, rsp *http.Response, err error, n int) (time.Duration, bool) {
+	backoff := retryBase << uint(n-1)
+	if backoff > retryCap {
+		backoff = retryCap
 	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
 
-	ht, err := hc.Tree()
-	if err != nil {
-		return fs, fmt.Errorf("head tree: %s", err)
+	// a request which may have reached the server is only retried if it is
+	// safe to repeat
+	var idem bool
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		idem = true
 	}
 
-	ct, err := cmt.Tree()
 	if err != nil {
-		return fs, fmt.Errorf("commit tree: %s", err)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return 0, false
+		}
+		return backoff, idem
 	}
 
-	cs, err := ht.Diff(ct)
-	if err != nil {
-		return fs, fmt.Errorf("diff: %s", err)
+	var after time.Duration
+	hasAfter := false
+	if s := rsp.Header.Get("Retry-After"); s != "" {
+		if i, err := strconv.Atoi(s); err == nil {
+			after, hasAfter = time.Duration(i)*time.Second, true
+		} else if t, err := http.ParseTime(s); err == nil {
+			after, hasAfter = time.Until(t), true
+		}
 	}
 
-	put := func(ss ...string) {
-		for _, s := range ss {
-			if s == "" {
-				continue
-			}
-			fs[s] = true
-			for {
-				d := path.Dir(s)
-				if d == "." || d == "/" {
-					break
-				}
-				s = d
-				fs[s] = true
+	switch {
+	case rsp.StatusCode == http.StatusForbidden || rsp.StatusCode == http.StatusTooManyRequests:
+		// a rate limited request was not processed, so it is safe to repeat
+		if hasAfter {
+			return after, true
+		}
+		if rsp.Header.Get("X-RateLimit-Remaining") == "0" {
+			i, err := strconv.ParseInt(rsp.Header.Get("X-RateLimit-Reset"), 10, 64)
+			if err == nil {
+				return time.Until(time.Unix(i, 0)) + time.Second, true
 			}
 		}
+		if rsp.StatusCode == http.StatusTooManyRequests {
+			return backoff, true
+		}
+		// a secondary rate limit is only identified by the message, the
+		// body is restored for the caller
+		b, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1<<16))
+		rsp.Body.Close()
+		rsp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if bytes.Contains(bytes.ToLower(b), []byte("secondary rate limit")) ||
+			bytes.Contains(bytes.ToLower(b), []byte("abuse")) {
+			return secondaryWait, true
+		}
+		return 0, false
+	case rsp.StatusCode >= 500:
+		if hasAfter {
+			return after, idem
+		}
+		return backoff, idem && rsp.StatusCode != http.StatusNotImplemented
 	}
+	return 0, false
+}
 
-	for _, c := range cs {
-		put(c.From.Name, c.To.Name)
-	}
-	return fs, nil
+// meter reports the bytes transferred by uploads and downloads on stderr. On
+// a terminal it redraws a line for each transfer and the total below any log
+// output, otherwise it logs a line for each transfer every meterEvery.
+type meter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tty   bool
+	quiet bool
+	ts    []*transfer
+	lines int       // the number of lines drawn on the terminal
+	drawn time.Time // when the lines were last drawn
 }
 
-// isRelease returns true if the version has changed in the HEAD commit.
-func (vr versioner) isRelease() (bool, error) {
-	head, err := vr.Head()
-	if err != nil {
-		return false, err
-	}
+// transfer counts the bytes of an upload or download on a meter.
+type transfer struct {
+	m     *meter
+	name  string
+	size  int64
+	n     int64
+	off   int64 // bytes already present when the transfer started
+	start time.Time
+	log   time.Time
+}
 
-	hc, err := vr.CommitObject(head.Hash())
-	if err != nil {
-		return false, err
-	}
+// the intervals between progress reports on a terminal and in a log
+const (
+	meterRedraw = 200 * time.Millisecond
+	meterEvery  = 10 * time.Second
+)
 
-	switch hc.NumParents() {
-	case 1:
-	case 0:
-		// no parent probably counts as a kind of release
-		return true, nil
-	default:
-		// merge commits cannot be releases
-		return false, nil
+// newMeter creates a meter writing to f, which is a terminal or a log.
+// A quiet meter reports nothing.
+func newMeter(f *os.File, quiet bool) *meter {
+	m := &meter{w: f, quiet: quiet}
+	if st, err := f.Stat(); err == nil {
+		m.tty = st.Mode()&os.ModeCharDevice != 0
 	}
+	return m
+}
 
-	hv, err := vr.at(hc)
-	if err != nil {
-		return false, err
-	}
+// start begins a transfer of size bytes named name, of which off bytes were
+// already transferred. Write the transferred bytes to the transfer and call
+// done when it ends.
+func (m *meter) start(name string, size, off int64) *transfer {
+	t := &transfer{m: m, name: name, size: size, n: off, off: off, start: time.Now()}
+	t.log = t.start
+	m.mu.Lock()
+	m.ts = append(m.ts, t)
+	m.mu.Unlock()
+	return t
+}
 
-	pc, err := hc.Parent(0)
-	if err != nil {
-		return false, err
-	}
+// Write implements io.Writer, counting the bytes in b.
+func (t *transfer) Write(b []byte) (int, error) {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	t.n += int64(len(b))
+	t.m.report(false)
+	return len(b), nil
+}
 
-	pv, err := vr.at(pc)
-	if err != nil {
-		return false, err
+// done ends the transfer.
+func (t *transfer) done() {
+	m := t.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.ts {
+		if m.ts[i] == t {
+			m.ts = append(m.ts[:i], m.ts[i+1:]...)
+			break
+		}
 	}
+	// a transfer long enough to have been logged also logs its end
+	if !m.quiet && !m.tty && t.log != t.start {
+		fmt.Fprintln(m.w, t)
+	}
+	m.report(true)
+}
 
-	return hv != pv, nil
+// Write implements io.Writer so the meter may be the output of log, the
+// transfer lines are redrawn below each log line. On a terminal the lines
+// are cleared first.
+func (m *meter) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clear()
+	n, err := m.w.Write(b)
+	m.report(true)
+	return n, err
 }
 
-// lastLog returns the content of the version file at HEAD.
-func (vr versioner) lastLog() (string, error) {
-	h, err := vr.Head()
-	if err != nil {
-		return "", err
+// clear erases the lines drawn on a terminal, the caller holds the lock.
+func (m *meter) clear() {
+	if m.lines > 0 {
+		fmt.Fprintf(m.w, "\x1b[%dA\x1b[J", m.lines)
+		m.lines = 0
 	}
+}
 
-	c, err := vr.CommitObject(h.Hash())
-	if err != nil {
-		return "", err
+// report draws or logs the transfers if it is time to, or now if force is
+// set, the caller holds the lock.
+func (m *meter) report(force bool) {
+	if m.quiet {
+		return
 	}
+	now := time.Now()
 
-	t, err := c.Tree()
-	if err != nil {
-		return "", err
+	if !m.tty {
+		for _, t := range m.ts {
+			if now.Sub(t.log) >= meterEvery {
+				t.log = now
+				fmt.Fprintln(m.w, t)
+			}
+		}
+		return
 	}
 
-	f, err := t.File(vr.path)
-	if err == object.ErrFileNotFound {
-		return "", nil
+	if !force && now.Sub(m.drawn) < meterRedraw {
+		return
 	}
-	if err != nil {
-		return "", err
+	m.drawn = now
+	m.clear()
+	if len(m.ts) == 0 {
+		return
 	}
 
-	return f.Contents()
+	total := transfer{name: "total", start: now}
+	for _, t := range m.ts {
+		fmt.Fprintln(m.w, t)
+		total.size += t.size
+		total.n += t.n
+		total.off += t.off
+		if t.start.Before(total.start) {
+			total.start = t.start
+		}
+	}
+	m.lines = len(m.ts)
+	if len(m.ts) > 1 {
+		fmt.Fprintln(m.w, &total)
+		m.lines++
+	}
 }
 
-// logHead creates a changelog from the previous release up to HEAD. The log is
-// very complicated.
-//
-// First, a mainline of commits is calculated. If a parent of a merge commit has
-// the same version as the child, it is considered mainline.
-//
-// After the mainline is calculated, the log is constructed from the commit
-// messages of the mainline up to and not including the previous release commit.
-//
-// Any branches encountered during the second traversal are tracked back to the
-// mainline and their commit messages are inserted into the log.
-func (vr versioner) logHead() ([]string, error) {
-	h, err := vr.Head()
-	if err != nil {
-		return []string{}, err
+// String formats the bytes, percentage, rate and estimated time remaining of
+// the transfer.
+func (t *transfer) String() string {
+	s := t.name + "  " + byteSize(t.n)
+	if t.size > 0 {
+		s += fmt.Sprintf(" / %s  %3d%%", byteSize(t.size), t.n*100/t.size)
 	}
-
-	hc, err := vr.CommitObject(h.Hash())
-	if err != nil {
-		return []string{}, err
+	secs := time.Since(t.start).Seconds()
+	if secs <= 0 || t.n == t.off {
+		return s
 	}
-
-	ml, err := vr.mainline(hc)
-	if err != nil {
-		return []string{}, err
+	rate := float64(t.n-t.off) / secs
+	s += "  " + byteSize(int64(rate)) + "/s"
+	if t.size > t.n {
+		eta := time.Duration(float64(t.size-t.n) / rate * float64(time.Second))
+		s += "  eta " + eta.Round(time.Second).String()
 	}
-
-	return vr.logMain(hc, ml)
+	return s
 }
 
-// logMain constructs a changelog starting from c along the mainline ml.  The
-// log is constructed from the commit messages of the mainline up to and not
-// including the previous release commit.
-//
-// Any branches encountered during the second traversal are tracked back to the
-// mainline and their commit messages are inserted into the log.
-func (vr versioner) logMain(c *object.Commit, ml map[plumbing.Hash]bool) ([]string, error) {
-	snd, rcv := passCommits()
-	snd <- c
-
-	msgs := []string{}
-	for c := range rcv {
-		switch {
-		case c == nil:
-		case c.NumParents() == 0:
-			msgs = append(msgs, c.Message)
-		case c.NumParents() == 1:
-			cv, err := vr.at(c)
-			if err != nil {
-				return msgs, err
-			}
-			pc, err := c.Parent(0)
-			if err != nil {
-				return msgs, err
-			}
-			pv, err := vr.at(pc)
-			if err != nil {
-				return msgs, err
-			}
-			if cv != pv {
-				continue
-			}
-			msgs = append(msgs, c.Message)
-			snd <- pc
-		default:
-			msgs = append(msgs, c.Message)
-			err := c.Parents().ForEach(func(c *object.Commit) error {
-				switch {
-				case ml[c.Hash]:
-					snd <- c
-				default:
-					msgs = append(msgs, vr.logBranch(c, ml)...)
-				}
-				return nil
-			})
-			if err != nil {
-				return msgs, err
-			}
-		}
+// byteSize formats n bytes using binary units.
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	d, e := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		d *= unit
+		e++
 	}
-	return msgs, nil
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(d), "KMGTPE"[e])
 }
 
-// logBranch constructs a branch changelog starting from c back to the mainline
-// ml. It returns a slice of all commit messages on the branch.
-func (vr versioner) logBranch(c *object.Commit, ml map[plumbing.Hash]bool) []string {
-	snd, rcv := passCommits()
-	snd <- c
-
-	ss := []string{}
-	for c := range rcv {
-		if c == nil {
-			continue
-		}
+// the name of the checksum manifest asset of a release
+const sumsName = "SHA256SUMS"
 
-		if ml[c.Hash] {
-			continue
-		}
+// the extension of a detached signature asset
+const sigExt = ".sig"
 
-		ss = append(ss, c.Message)
+// sigMessage returns the message signed for the asset name of the release
+// tag with the sha256 digest h. The tag and name are signed with the digest so
+// that a signed asset cannot be replayed as another asset or release, such
+// as an older version.
+func sigMessage(tag, name string, h []byte) []byte {
+	return []byte(fmt.Sprintf("hubr signature v1\ntag %s\nasset %s\nsha256 %x\n", tag, name, h))
+}
 
-		if c.NumParents() == 0 {
-			continue
-		}
+// sign returns a detached signature of b as the asset name of the release tag.
+// The signature is an ed25519 signature of the sigMessage of the sha256
+// digest of b, base64 encoded on one line.
+func sign(key ed25519.PrivateKey, tag, name string, b []byte) []byte {
+	h := sha256.Sum256(b)
+	return encodeSig(ed25519.Sign(key, sigMessage(tag, name, h[:])))
+}
 
-		c.Parents().ForEach(func(c *object.Commit) error {
-			snd <- c
-			return nil
-		})
+// signFile returns a detached signature of the file at path, as with sign.
+func signFile(key ed25519.PrivateKey, tag, name, path string) ([]byte, error) {
+	sum, err := fileSum(path)
+	if err != nil {
+		return nil, err
 	}
-	return ss
+	h, _ := hex.DecodeString(sum)
+	return encodeSig(ed25519.Sign(key, sigMessage(tag, name, h))), nil
 }
 
-// mainline traverses commits from c and returns a map of commit hashes which
-// are considered the mainline. For any merge commit encountered, its parents
-// are considered mainline if they have the same version as the child.
-// Note: doing things this way is probably not sustainable. But it's a start.
-func (vr versioner) mainline(c *object.Commit) (map[plumbing.Hash]bool, error) {
-	snd, rcv := passCommits()
-	snd <- c
+// encodeSig encodes a signature for a signature asset.
+func encodeSig(sig []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
 
-	ml := map[plumbing.Hash]bool{}
-	for c := range rcv {
-		if c == nil {
-			continue
+// verify checks the detached signature sig of the asset name of the release
+// tag with the sha256 digest h against the trusted keys. It returns nil if any
+// key verifies the signature.
+func verify(keys []ed25519.PublicKey, tag, name string, h, sig []byte) error {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || len(b) != ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	for _, k := range keys {
+		if ed25519.Verify(k, sigMessage(tag, name, h), b) {
+			return nil
 		}
+	}
+	return errors.New("signature is not from a trusted key")
+}
 
-		if ml[c.Hash] {
-			continue
-		}
+// readKeyFile returns the base64 decoded lines of a key file. Blank lines and
+// lines starting with # are ignored.
+func readKeyFile(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-		np := c.NumParents()
-		if np == 0 {
-			ml[c.Hash] = true
+	bs := [][]byte{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || l[0] == '#' {
 			continue
 		}
-
-		cv, err := vr.at(c)
+		b, err := base64.StdEncoding.DecodeString(l)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %s", path, err)
 		}
+		bs = append(bs, b)
+	}
+	return bs, s.Err()
+}
 
-		err = c.Parents().ForEach(func(c *object.Commit) error {
-			if np > 1 {
-				pv, err := vr.at(c)
-				if err != nil {
-					return err
-				}
-				if cv != pv {
-					return nil
-				}
-			}
+// loadSigningKey reads an ed25519 private key from a key file created by
+// hubr keygen. An empty path returns a nil key.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	bs, err := readKeyFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %s", err)
+	}
+	if len(bs) != 1 || len(bs[0]) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signing key: %s is not an ed25519 private key", path)
+	}
+	return ed25519.PrivateKey(bs[0]), nil
+}
 
-			snd <- c
-			return nil
-		})
-		ml[c.Hash] = true
-		if err != nil {
-			return ml, err
+// loadTrustedKeys reads ed25519 public keys from a key file, one per line. An
+// empty path returns no keys.
+func loadTrustedKeys(path string) ([]ed25519.PublicKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	bs, err := readKeyFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("trusted keys: %s", err)
+	}
+	ks := []ed25519.PublicKey{}
+	for _, b := range bs {
+		if len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("trusted keys: %s has a line which is not an ed25519 public key", path)
 		}
+		ks = append(ks, ed25519.PublicKey(b))
 	}
-	return ml, nil
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("trusted keys: %s has no keys", path)
+	}
+	return ks, nil
 }
 
-// hubr assemble! setup the subcmds and maybe invoke one.
-func main() {
-	subs := map[string]struct {
-		fn  func([]string) error
-		use string
-	}{
-		"assets":  {assets, "list release assets"},
-		"bump":    {bump, "create a new version"},
-		"cat":     {cat, "print release asset contents"},
-		"get":     {get, "download release assets"},
-		"install": {install, "install binary or zip assets"},
-		"now":     {now, "test for a release commit"},
-		"push":    {push, "release using version file"},
-		"release": {release, "release by tag"},
-		"resolve": {resolve, "resolve a tag"},
-		"say":     {say, "octocat says"},
-		"tags":    {tags, "list release tags"},
-		"what":    {what, "list or check file changes"},
-		"who":     {who, "get token user"},
-	}
-	flag.Usage = func() {
-		o := flag.CommandLine.Output()
-		fmt.Fprintf(o, helpMain, os.Args[0], os.Args[0])
-		fmt.Fprintln(o, "\nOptions:")
-		flag.PrintDefaults()
-		// print the subcmds in a style matching the flag package
-		fmt.Fprintln(o, "\nCommands:")
-		// this slice hides hidden/utility subs from the main help output
-		ks := []string{"assets", "bump", "cat", "get", "install", "now",
-			"push", "release", "resolve", "tags", "what", "who"}
-		for _, k := range ks {
-			fmt.Fprintf(o, "  %s\n    \t%s\n", k, subs[k].use)
+// sums is a checksum manifest, mapping file names to hex sha256 sums.
+type sums map[string]string
+
+// parseSums reads a checksum manifest in the format of sha256sum, one sum and
+// file name per line.
+func parseSums(r io.Reader) (sums, error) {
+	ss := sums{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
 		}
-		fmt.Fprintln(o)
+		p := strings.Fields(l)
+		if len(p) != 2 || len(p[0]) != sha256.Size*2 {
+			return ss, errors.New("invalid checksum line: " + l)
+		}
+		ss[strings.TrimPrefix(p[1], "*")] = strings.ToLower(p[0])
 	}
+	return ss, s.Err()
+}
 
-	v := flag.Bool("v", false, "print version on standard output and exit")
-	flag.Parse()
-	if *v {
-		fmt.Println(hubr + "-" + runtime.GOOS + "-" + runtime.GOARCH)
-		os.Exit(0)
+// String formats the manifest in the format of sha256sum, sorted by name.
+func (ss sums) String() string {
+	ns := []string{}
+	for n := range ss {
+		ns = append(ns, n)
 	}
-	if flag.NArg() == 0 {
-		flag.Usage()
-		os.Exit(2)
+	sort.Strings(ns)
+	b := strings.Builder{}
+	for _, n := range ns {
+		b.WriteString(ss[n] + "  " + n + "\n")
 	}
+	return b.String()
+}
 
-	sub, ok := subs[flag.Arg(0)]
-	if !ok {
-		fmt.Fprintf(flag.CommandLine.Output(), "unrecognised command: %q\n\n", flag.Arg(0))
-		flag.Usage()
-		os.Exit(2)
+// fileSum returns the hex sha256 sum of the file at path.
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	log.SetFlags(0)
-	if err := sub.fn(flag.Args()[1:]); err != nil {
-		log.Fatal(err)
+// checkSum returns an error if want is not empty and is not the sum in h.
+func checkSum(id ident, want string, h hash.Hash) error {
+	if want == "" {
+		return nil
 	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch %s: %s lists %s, got %s", id, sumsName, want, got)
+	}
+	return nil
 }
 
-// Subcmd assets lists release assets for one or more GitHub releases.
-// With no flags, assets will be listed three per line.
-// With -l, one asset per line with content type, size and label
-// If more than one identifier is provided, headings are included.
-func assets(args []string) error {
-	f := flag.NewFlagSet("assets", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	list := f.Bool("l", false, "one per line, with description")
-	f.Parse(args)
+// tagRecord is the machine readable form of a tag and its release, if any.
+type tagRecord struct {
+	Ident     string     `json:"ident"`
+	Tag       string     `json:"tag"`
+	State     string     `json:"state"`
+	Created   *time.Time `json:"created,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	URL       string     `json:"url,omitempty"`
+}
 
-	args, err := readArgs(f.Args())
-	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
+// newTagRecord creates a tagRecord for tag t of the repo in id. The release r
+// may be nil if the tag has not been released.
+func newTagRecord(id ident, t string, r *github.RepositoryRelease) tagRecord {
+	id.tag, id.asset, id.dst = t, "", ""
+	tr := tagRecord{Ident: id.String(), Tag: t, State: releaseState(r)}
+	if r == nil {
+		return tr
 	}
-
-	if len(args) == 0 {
-		f.Usage()
-		os.Exit(2)
+	if r.CreatedAt != nil {
+		tr.Created = &r.CreatedAt.Time
+	}
+	if r.PublishedAt != nil {
+		tr.Published = &r.PublishedAt.Time
 	}
+	tr.URL = r.GetHTMLURL()
+	return tr
+}
 
-	c, err := newClient()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+// releaseState returns the state of a release: draft, pre or full. If r is nil
+// the state is tag, meaning unreleased.
+func releaseState(r *github.RepositoryRelease) string {
+	switch {
+	case r == nil:
+		return "tag"
+	case r.GetDraft():
+		return "draft"
+	case r.GetPrerelease():
+		return "pre"
+	}
+	return "full"
+}
+
+// assetRecord is the machine readable form of a release asset.
+type assetRecord struct {
+	Ident       string `json:"ident"`
+	Tag         string `json:"tag"`
+	State       string `json:"state"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+	Label       string `json:"label,omitempty"`
+	URL         string `json:"url"`
+}
+
+// newAssetRecord creates an assetRecord for asset a of release r.
+func newAssetRecord(id ident, r *github.RepositoryRelease, a github.ReleaseAsset) assetRecord {
+	id.tag, id.asset, id.dst = r.GetTagName(), a.GetName(), a.GetName()
+	return assetRecord{
+		Ident:       id.String(),
+		Tag:         r.GetTagName(),
+		State:       releaseState(r),
+		ID:          a.GetID(),
+		Name:        a.GetName(),
+		Size:        a.GetSize(),
+		ContentType: a.GetContentType(),
+		Label:       a.GetLabel(),
+		URL:         a.GetBrowserDownloadURL(),
 	}
+}
 
-	w := tabwriter.NewWriter(os.Stdout, 16, 8, 2, ' ', 0)
-	for _, arg := range args {
-		id, ok := parseID(arg)
-		if !ok {
-			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]")
-		}
+// userRecord is the machine readable form of a GitHub user.
+type userRecord struct {
+	Login string `json:"login"`
+	Name  string `json:"name,omitempty"`
+	URL   string `json:"url"`
+}
 
-		r, err := c.GetRelease(id)
+// newPrinter returns a function which writes records to w, either as one json
+// object per line if jsn is true, or using the text/template format followed
+// by a new line. If neither is requested the returned function is nil.
+func newPrinter(w io.Writer, jsn bool, format string) (func(interface{}) error, error) {
+	switch {
+	case jsn && format != "":
+		return nil, errors.New("-json and -format are mutually exclusive")
+	case jsn:
+		enc := json.NewEncoder(w)
+		return enc.Encode, nil
+	case format != "":
+		t, err := template.New("format").Parse(format)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("parse -format: %s", err)
 		}
+		return func(v interface{}) error {
+			if err := t.Execute(w, v); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		}, nil
+	}
+	return nil, nil
+}
 
-		id.tag = r.GetTagName()
-		if len(args) > 1 {
-			io.WriteString(w, id.String()+":\n")
-		}
-		if id.asset == "" {
-			id.asset = "*"
-		}
+type errNotFound struct {
+	ident
+}
 
-		i := 0
-		for _, a := range r.Assets {
-			ok, err := filepath.Match(id.asset, a.GetName())
-			if err != nil {
-				return fmt.Errorf("%s is not a valid glob pattern", id.asset)
-			}
-			if !ok {
-				continue
-			}
-			switch {
-			case *list:
-				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", a.GetName(),
-					a.GetContentType(), a.GetSize(), a.GetLabel())
-			default:
-				i++
-				n := "\t"
-				// format into 3 columns
-				if i%3 == 2 {
+func isNotFound(err error) bool {
+	_, ok := err.(errNotFound)
+	return ok
+}
+
+func (e errNotFound) Error() string {
+	return fmt.Sprintf("%s was not found", e.ident.String())
+}
+
+type errNoReleases struct {
+	ident
+}
+
+func isNoReleases(err error) bool {
+	_, ok := err.(errNoReleases)
+	return ok
+}
+
+func (e errNoReleases) Error() string {
+	return fmt.Sprintf("%s has no releases", e.ident.String())
+}
+
+// regexp pattern for ident
+const (
+	idSlugPart = `(?:([\d\w_-]+)/)?`
+	idRepoPart = `([\d\w_-]+)`
+	idTagPart  = `(?:@([\d\w\._+^~<>=|,*/ -]+))?`
+	idGlobPart = `(?::([\d\w\.\*\?\[\]\^_-]+))?`
+	idFilePart = `(?::([\d\w\._-]+))?`
+	idRe       = "^" + idSlugPart + idRepoPart + idTagPart + idGlobPart + idFilePart + "$"
+)
+
+// regexp for ident
+var (
+	idRx     = regexp.MustCompile(idRe)
+	noGlobRx = regexp.MustCompile(`^[\d\w\._-]+$`)
+)
+
+// ident can identify a repo, tag, or asset and destination name.
+type ident struct {
+	org, repo, tag, asset, dst string
+}
+
+func parseID(s string) (ident, bool) {
+	ms := idRx.FindStringSubmatch(s)
+	if len(ms) != 6 {
+		return ident{}, false
+	}
+	id := ident{ms[1], ms[2], ms[3], ms[4], ms[5]}
+	if id.org == "" {
+		id.org = defaultOrg
+	}
+	if id.org == "" {
+		log.Printf("%s has no org and HUBR_DEFAULT_ORG is not set", s)
+		return ident{}, false
+	}
+	if id.tag == "" {
+		id.tag = defaultTag
+	}
+	if isConstraint(id.tag) {
+		if _, _, err := tagConstraint(id.tag); err != nil {
+			log.Printf("%s: %s", s, err)
+			return ident{}, false
+		}
+	}
+	glob := !noGlobRx.MatchString(id.asset)
+	switch {
+	case glob && id.dst != "":
+		return ident{}, false
+	case !glob && id.dst == "":
+		id.dst = id.asset
+	}
+
+	return id, true
+}
+
+func (id ident) String() string {
+	s := id.org + "/" + id.repo
+	if id.tag != defaultTag {
+		s += "@" + id.tag
+	}
+	if id.asset != "" {
+		s += ":" + id.asset
+	}
+	if id.dst != id.asset && id.dst != "" {
+		s += ":" + id.dst
+	}
+	return s
+}
+
+// increment is a semver increment
+type increment int
+
+const (
+	noinc increment = iota
+	major
+	minor
+	patch
+	prerelease
+	rc
+	final
+	autoinc
+)
+
+// parseIncrement converts a string to an increment.
+func parseIncrement(s string) (increment, error) {
+	i := map[string]increment{
+		"major": major, "minor": minor, "patch": patch,
+		"prerelease": prerelease, "rc": rc, "release": final,
+		"auto": autoinc,
+	}[s]
+	if i == noinc {
+		return i, errors.New("not an increment: " + s)
+	}
+	return i, nil
+}
+
+// String returns a string representation of the increment.
+func (i increment) String() string {
+	return map[increment]string{
+		noinc: "invalid", major: "major", minor: "minor", patch: "patch",
+		prerelease: "prerelease", rc: "rc", final: "release", autoinc: "auto",
+	}[i]
+}
+
+// regexp of the header of a conventional commit, type(scope)!: description
+var commitRx = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: +(\S.*)$`)
+
+// regexp of a git trailer line, token: value
+var trailerRx = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*|BREAKING CHANGE): +(.*)$`)
+
+// logEntry is a commit of a changelog. A commit message is parsed as a
+// Conventional Commit, see https://www.conventionalcommits.org.
+type logEntry struct {
+	Hash     string
+	Author   string
+	Email    string
+	Date     time.Time
+	Type     string // the lower case type such as feat or fix, empty if not conventional
+	Scope    string
+	Breaking bool
+	Subject  string              // the description, or the first line if not conventional
+	Body     []string            // the remaining non-empty lines
+	Trailers map[string][]string // the trailers of the last paragraph, by token
+}
+
+// newLogEntry creates a log entry of the commit c.
+func newLogEntry(c *object.Commit) logEntry {
+	e := parseLogEntry(c.Message)
+	e.Hash = c.Hash.String()
+	e.Author = c.Author.Name
+	e.Email = c.Author.Email
+	e.Date = c.Author.When
+	return e
+}
+
+// parseLogEntry parses the commit message msg. A breaking change is marked by
+// a ! after the type or scope, or by a BREAKING CHANGE trailer.
+func parseLogEntry(msg string) logEntry {
+	e := logEntry{Trailers: map[string][]string{}}
+	msg = strings.TrimSpace(strings.Replace(msg, "\r", "", -1))
+
+	ps := strings.Split(msg, "\n\n")
+	if last := ps[len(ps)-1]; len(ps) > 1 {
+		ts := map[string][]string{}
+		for _, l := range strings.Split(last, "\n") {
+			ms := trailerRx.FindStringSubmatch(l)
+			if ms == nil {
+				ts = nil
+				break
+			}
+			ts[ms[1]] = append(ts[ms[1]], ms[2])
+		}
+		if ts != nil {
+			e.Trailers = ts
+		}
+	}
+
+	ls := []string{}
+	for _, l := range strings.Split(msg, "\n") {
+		if l = strings.TrimRight(l, " "); l != "" {
+			ls = append(ls, l)
+		}
+	}
+	if len(ls) == 0 {
+		return e
+	}
+
+	e.Subject, e.Body = ls[0], ls[1:]
+	ms := commitRx.FindStringSubmatch(ls[0])
+	if ms == nil {
+		return e
+	}
+	e.Type, e.Scope, e.Breaking, e.Subject = strings.ToLower(ms[1]), ms[2], ms[3] == "!", ms[4]
+	if len(e.Trailers["BREAKING CHANGE"]) > 0 || len(e.Trailers["BREAKING-CHANGE"]) > 0 {
+		e.Breaking = true
+	}
+	return e
+}
+
+// increment returns the increment required by the entry: major for a
+// breaking change, minor for a feature and patch for anything else.
+func (e logEntry) increment() increment {
+	switch {
+	case e.Breaking:
+		return major
+	case e.Type == "feat":
+		return minor
+	}
+	return patch
+}
+
+// conventionalIncrement returns the largest increment required by the log
+// entries es, which is patch if there are none.
+func conventionalIncrement(es []logEntry) increment {
+	inc := patch
+	for _, e := range es {
+		// increments are ordered from major, the largest, to patch
+		if i := e.increment(); i < inc {
+			inc = i
+		}
+	}
+	return inc
+}
+
+// changelog is the data given to a changelog template. The commits are also
+// grouped by their conventional commit type, breaking changes first, and the
+// sections list the groups which are not empty in that order.
+type changelog struct {
+	Version      string
+	Previous     string
+	Date         time.Time
+	Commits      []logEntry
+	Conventional bool // any commit is a conventional commit
+	Breaking     []logEntry
+	Features     []logEntry
+	Fixes        []logEntry
+	Other        []logEntry
+	Sections     []logSection
+}
+
+// logSection is a titled group of changelog commits.
+type logSection struct {
+	Title   string
+	Commits []logEntry
+}
+
+// newChangelog creates the changelog of version v from the previous version
+// prev. Entries without a subject are left out.
+func newChangelog(v, prev version, es []logEntry) changelog {
+	cl := changelog{Version: v.String(), Previous: prev.String(), Date: time.Now(), Commits: []logEntry{}}
+	if prev == "" {
+		cl.Previous = ""
+	}
+	for _, e := range es {
+		if e.Subject == "" {
+			continue
+		}
+		cl.Commits = append(cl.Commits, e)
+		cl.Conventional = cl.Conventional || e.Type != ""
+		switch {
+		case e.Breaking:
+			cl.Breaking = append(cl.Breaking, e)
+		case e.Type == "feat":
+			cl.Features = append(cl.Features, e)
+		case e.Type == "fix":
+			cl.Fixes = append(cl.Fixes, e)
+		default:
+			cl.Other = append(cl.Other, e)
+		}
+	}
+	for _, sec := range []logSection{
+		{"Breaking changes", cl.Breaking},
+		{"Features", cl.Features},
+		{"Fixes", cl.Fixes},
+		{"Other", cl.Other},
+	} {
+		if len(sec.Commits) > 0 {
+			cl.Sections = append(cl.Sections, sec)
+		}
+	}
+	return cl
+}
+
+// the name of a repository changelog template file, at the repository root
+const changelogFile = ".hubr-changelog.tmpl"
+
+// the built in changelog templates. The plain template lists the commits,
+// grouped into sections if any is a conventional commit.
+var changelogTemplates = map[string]string{
+	"plain": `{{if .Conventional}}{{range $i, $s := .Sections}}{{if $i}}
+{{end}}{{.Title}}:
+{{range .Commits}}- {{with .Scope}}{{.}}: {{end}}{{.Subject}}
+{{range .Body}}  {{.}}
+{{end}}{{end}}{{end}}{{else}}{{range .Commits}}- {{.Subject}}
+{{range .Body}}  {{.}}
+{{end}}{{end}}{{end}}`,
+
+	"markdown": `## {{.Version}} ({{.Date.Format "2006-01-02"}})
+{{if .Conventional}}{{range .Sections}}
+### {{.Title}}
+
+{{range .Commits}}- {{with .Scope}}**{{.}}:** {{end}}{{.Subject}}{{with .Hash}} ({{printf "%.7s" .}}){{end}}
+{{end}}{{end}}{{else}}
+{{range .Commits}}- {{.Subject}}{{with .Hash}} ({{printf "%.7s" .}}){{end}}
+{{end}}{{end}}`,
+
+	"keepachangelog": `## [{{.Version}}] - {{.Date.Format "2006-01-02"}}
+{{with .Features}}
+### Added
+
+{{range .}}- {{.Subject}}
+{{end}}{{end}}{{if or .Breaking .Other}}
+### Changed
+
+{{range .Breaking}}- **BREAKING:** {{.Subject}}
+{{end}}{{range .Other}}- {{.Subject}}
+{{end}}{{end}}{{with .Fixes}}
+### Fixed
+
+{{range .}}- {{.Subject}}
+{{end}}{{end}}`,
+}
+
+// loadChangelogTemplate returns the changelog template named by s, which is
+// the name of a built in template or a file. If s is empty the template is
+// read from the repository changelog template file, and if there is none the
+// template is nil.
+func loadChangelogTemplate(s string) (*template.Template, error) {
+	if t, ok := changelogTemplates[s]; ok {
+		return template.New(s).Parse(t)
+	}
+
+	p := s
+	if s == "" {
+		dir, err := locateGitDir(".")
+		if err != nil {
+			return nil, nil
+		}
+		p = filepath.Join(dir, changelogFile)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("read changelog template: %s", err)
+	}
+	t, err := template.New(filepath.Base(p)).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("parse changelog template: %s", err)
+	}
+	return t, nil
+}
+
+// render executes the changelog template t, the result ends in a single new
+// line unless it is empty.
+func (cl changelog) render(t *template.Template) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, cl); err != nil {
+		return "", fmt.Errorf("changelog template: %s", err)
+	}
+	s := strings.TrimRight(b.String(), "\n")
+	if s == "" {
+		return "", nil
+	}
+	return s + "\n", nil
+}
+
+// spec is a set of parameters to create or update a release.
+type spec struct {
+	id                      ident
+	draft, pre, keepd, sums bool
+	sha, name, body         string
+	uploads                 []string
+	wkrs                    int
+	key                     ed25519.PrivateKey
+}
+
+// release does exactly what it says. A tag is created if one does not
+// exist. A release is created if one does not exist. Files listed in uploads
+// are uploaded.
+func (s spec) release() error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	err = c.CreateTag(s.id, s.sha, "release "+s.name)
+	if err != nil {
+		return fmt.Errorf("tag: %s", err)
+	}
+
+	r, err := c.DraftRelease(s.id, s.name, s.body, s.pre)
+	if err != nil {
+		return fmt.Errorf("draft release: %s", err)
+	}
+
+	if len(s.uploads) > 0 {
+		u, err := newUpper(c, s.wkrs, s.id, r, s.key)
+		if err != nil {
+			return err
+		}
+		ss := sums{}
+		for _, src := range s.uploads {
+			dst := src
+			if !s.keepd {
+				dst = filepath.Base(src)
+			}
+			if s.sums && dst != sumsName {
+				sum, err := fileSum(src)
+				if err != nil {
+					u.wait()
+					return fmt.Errorf("checksum: %s", err)
+				}
+				ss[dst] = sum
+			}
+			u.queue(dst, src)
+			log.Print("uploading ", src)
+		}
+		errs := u.wait()
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Print(err)
+			}
+			return errors.New("uploads failed")
+		}
+
+		if s.sums {
+			log.Print("uploading ", sumsName)
+			if err := c.PutSums(s.id, r, ss, s.key); err != nil {
+				return fmt.Errorf("upload %s: %s", sumsName, err)
+			}
+		}
+	}
+
+	if s.draft {
+		log.Print(s.id.repo, " ", s.id.tag, " draft release updated")
+		return s.outputs(c, r)
+	}
+
+	err = c.PublishRelease(s.id)
+	if err != nil {
+		return fmt.Errorf("publish release: %s", err)
+	}
+
+	octolog(c, s.id.String()+" released!")
+	return s.outputs(c, r)
+}
+
+// outputs sets the step outputs of the release r when running in GitHub
+// Actions: released, draft, tag, sha, release_id, release_url, upload_url and
+// asset_urls, one download url per line.
+func (s spec) outputs(c *client, r *github.RepositoryRelease) error {
+	if actionsEnv("GITHUB_OUTPUT") == "" {
+		return nil
+	}
+	// publishing changes the url of a draft
+	r, _, err := c.Repositories.GetRelease(ctxbg, s.id.org, s.id.repo, r.GetID())
+	if err != nil {
+		return fmt.Errorf("step outputs: get release: %s", err)
+	}
+	as, err := c.ListAssets(s.id, r)
+	if err != nil {
+		return fmt.Errorf("step outputs: %s", err)
+	}
+	us := []string{}
+	for _, a := range as {
+		us = append(us, a.GetBrowserDownloadURL())
+	}
+	return setOutputs(
+		"released", "true",
+		"draft", strconv.FormatBool(r.GetDraft()),
+		"tag", s.id.tag,
+		"sha", s.sha,
+		"release_id", strconv.FormatInt(r.GetID(), 10),
+		"release_url", r.GetHTMLURL(),
+		"upload_url", r.GetUploadURL(),
+		"asset_urls", strings.Join(us, "\n"),
+	)
+}
+
+// versionRe matches a semver of the form 0.0.0 with any prefix or suffix.
+var versionRe = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// semverRx matches a whole semver string 0.0.0-pre+build with an optional v
+// prefix. Only such a version has a prerelease and build metadata, so that a
+// suffix such as that of tool-1.2.3-linux-amd64 is not taken for a prerelease.
+var semverRx = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// version is a semver version of the form 0.0.0-pre+build with any prefix or
+// suffix
+type version string
+
+// parseVersion converts a string into a version. It returns an error if s does
+// not match the version regexp.
+func parseVersion(s string) (version, error) {
+	if !versionRe.MatchString(s) {
+		return version(""), errors.New("version does not match 0.0.0 pattern")
+	}
+	return version(s), nil
+}
+
+// semver is the parsed form of a version. The prefix and suffix are anything
+// either side of the match of versionRe, unless the version matches semverRx.
+type semver struct {
+	prefix, suffix      string
+	major, minor, patch int
+	pre                 []string
+	build               string
+}
+
+// semver parses the version. If v does not match the version regexp the
+// result is v0.0.0.
+func (v version) semver() semver {
+	s := strings.TrimRight(string(v), "\n")
+	if ms := semverRx.FindStringSubmatch(s); ms != nil {
+		sv := semver{prefix: ms[1], build: ms[6]}
+		sv.major, _ = strconv.Atoi(ms[2])
+		sv.minor, _ = strconv.Atoi(ms[3])
+		sv.patch, _ = strconv.Atoi(ms[4])
+		if ms[5] != "" {
+			sv.pre = strings.Split(ms[5], ".")
+		}
+		return sv
+	}
+
+	l := versionRe.FindStringSubmatchIndex(s)
+	if l == nil {
+		return semver{prefix: "v"}
+	}
+	ms := versionRe.FindStringSubmatch(s)
+	sv := semver{prefix: s[:l[0]], suffix: s[l[1]:]}
+	sv.major, _ = strconv.Atoi(ms[1])
+	sv.minor, _ = strconv.Atoi(ms[2])
+	sv.patch, _ = strconv.Atoi(ms[3])
+	return sv
+}
+
+// String formats the semver, normalised to 0.0.0 form.
+func (sv semver) String() string {
+	s := sv.prefix + strconv.Itoa(sv.major) + "." + strconv.Itoa(sv.minor) + "." + strconv.Itoa(sv.patch)
+	if len(sv.pre) > 0 {
+		s += "-" + strings.Join(sv.pre, ".")
+	}
+	if sv.build != "" {
+		s += "+" + sv.build
+	}
+	return s + sv.suffix
+}
+
+// bump returns a new version incremented as instructed. Build metadata is
+// always dropped. Prereleases are incremented like npm semver.
+//
+// Major, minor and patch release a prerelease if it precedes that version, so
+// 1.3.0-rc.1 minor is 1.3.0, otherwise the part is incremented. Prerelease
+// increments the last numeric identifier of a prerelease or appends one,
+// otherwise it increments the patch and appends -0. Rc increments an rc.N
+// prerelease, changes other prereleases to rc.1, otherwise it increments the
+// patch and appends -rc.1. Final drops the prerelease.
+//
+// An error is returned if the new version does not have a higher precedence,
+// such as rc of 1.3.0-rc1, which would be 1.3.0-rc.1.
+func (v version) bump(incr increment) (version, error) {
+	sv := v.semver()
+	pre := len(sv.pre) > 0
+	sv.build = ""
+
+	switch incr {
+	case major:
+		if !pre || sv.minor != 0 || sv.patch != 0 {
+			sv.major++
+		}
+		sv.minor, sv.patch, sv.pre = 0, 0, nil
+	case minor:
+		if !pre || sv.patch != 0 {
+			sv.minor++
+		}
+		sv.patch, sv.pre = 0, nil
+	case patch:
+		if !pre {
+			sv.patch++
+		}
+		sv.pre = nil
+	case prerelease:
+		if !pre {
+			sv.patch++
+			sv.pre = []string{"0"}
+			break
+		}
+		sv.pre = append([]string{}, sv.pre...)
+		i := len(sv.pre) - 1
+		for ; i >= 0; i-- {
+			if n, err := strconv.Atoi(sv.pre[i]); err == nil {
+				sv.pre[i] = strconv.Itoa(n + 1)
+				break
+			}
+		}
+		if i < 0 {
+			sv.pre = append(sv.pre, "0")
+		}
+	case rc:
+		switch {
+		case !pre:
+			sv.patch++
+			sv.pre = []string{"rc", "1"}
+		case sv.pre[0] == "rc" && len(sv.pre) > 1:
+			n, _ := strconv.Atoi(sv.pre[1])
+			sv.pre = []string{"rc", strconv.Itoa(n + 1)}
+		default:
+			sv.pre = []string{"rc", "1"}
+		}
+	case final:
+		sv.pre = nil
+	}
+
+	b := version(sv.String())
+	if b.compare(v) <= 0 {
+		return v, fmt.Errorf("bump %s: %s does not follow %s", incr, b, v)
+	}
+	return b, nil
+}
+
+// isPrerelease returns true if v has a prerelease part.
+func (v version) isPrerelease() bool {
+	return len(v.semver().pre) > 0
+}
+
+// isBefore returns true if v is an earlier version than u. Any prefixes or
+// suffixes are ignored.
+func (v version) isBefore(u version) bool {
+	return v.compare(u) < 0
+}
+
+// compare returns -1, 0 or 1 if v has lower, equal or higher precedence than u
+// according to the semver spec. Any prefixes, suffixes and build metadata are
+// ignored.
+func (v version) compare(u version) int {
+	vs, us := v.semver(), u.semver()
+
+	for _, p := range [][2]int{
+		{vs.major, us.major}, {vs.minor, us.minor}, {vs.patch, us.patch},
+	} {
+		switch {
+		case p[0] < p[1]:
+			return -1
+		case p[0] > p[1]:
+			return 1
+		}
+	}
+
+	// a version without a prerelease has higher precedence
+	switch {
+	case len(vs.pre) == 0 && len(us.pre) == 0:
+		return 0
+	case len(vs.pre) == 0:
+		return 1
+	case len(us.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(vs.pre) && i < len(us.pre); i++ {
+		if c := comparePre(vs.pre[i], us.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(vs.pre) < len(us.pre):
+		return -1
+	case len(vs.pre) > len(us.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePre compares prerelease identifiers. Numeric identifiers compare
+// numerically and have lower precedence than alphanumeric identifiers, which
+// compare lexically.
+func comparePre(a, b string) int {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// String returns the version string or v0.0.0 if the string is empty.
+func (v version) String() string {
+	if v == "" {
+		return "v0.0.0"
+	}
+	return strings.TrimRight(string(v), "\n")
+}
+
+// constraint is a semver range expression. It is a list of alternative
+// ranges, each a list of comparators which must all be satisfied.
+type constraint [][]comparator
+
+// comparator compares a version to v using op, one of < <= > >= =.
+type comparator struct {
+	op string
+	v  version
+}
+
+// constraintRx matches one comparator of a constraint. The version may be
+// partial or use x or * wildcards.
+var constraintRx = regexp.MustCompile(`^(\^|~|>=|<=|>|<|=)?v?` +
+	`(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// isConstraint returns true if a tag is a semver constraint rather than a
+// literal tag. A constraint has an operator, a wildcard or more than one
+// comparator. A wildcard is an x, X or * part following only numeric parts,
+// so that 1.x is a constraint but release-1.x is a literal tag. The
+// constraint may follow a tag prefix ending with a slash, see tagConstraint.
+func isConstraint(tag string) bool {
+	_, tag = splitTagPrefix(tag)
+	if tag == "" {
+		return false
+	}
+	if strings.ContainsAny(tag[:1], "^~<>=*") || strings.ContainsAny(tag, " ,|") {
+		return true
+	}
+	ps := strings.Split(strings.TrimPrefix(tag, "v"), ".")
+	for i, p := range ps {
+		if p == "x" || p == "X" || p == "*" {
+			return i > 0
+		}
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// splitTagPrefix splits a tag after its last slash into the tag prefix of a
+// component, such as svc-a/, and the rest.
+func splitTagPrefix(tag string) (string, string) {
+	i := strings.LastIndexByte(tag, '/')
+	return tag[:i+1], tag[i+1:]
+}
+
+// tagConstraint parses the constraint of a tag, which may follow the tag
+// prefix of a component such as svc-a/^1.2, and returns the prefix and the
+// constraint.
+func tagConstraint(tag string) (string, constraint, error) {
+	prefix, s := splitTagPrefix(tag)
+	cs, err := parseConstraint(s)
+	return prefix, cs, err
+}
+
+// parseConstraint parses a constraint expression. Ranges are separated by ||
+// and comparators within a range by spaces or commas. A comparator is an
+// operator and a version, which may be partial, such as ^1.4, ~2.3.1, >=1.0,
+// <2, 1.x or 1.4.*. The operators are ^ (compatible with), ~ (same minor),
+// < <= > >= and =. Without an operator a partial version matches any version
+// it is a prefix of, such as 1.4 in "1.4 || 2.x". A lone partial version is
+// not a constraint, see isConstraint, it is a literal tag such as v1.
+func parseConstraint(s string) (constraint, error) {
+	cs := constraint{}
+	for _, r := range strings.Split(s, "||") {
+		// allow a space between an operator and the version
+		for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			r = strings.Replace(r, op+" ", op, -1)
+		}
+		cmps := []comparator{}
+		for _, e := range strings.FieldsFunc(r, func(r rune) bool { return r == ' ' || r == ',' }) {
+			c, err := parseComparator(e)
+			if err != nil {
+				return nil, err
+			}
+			cmps = append(cmps, c...)
+		}
+		if len(cmps) == 0 {
+			return nil, errors.New("empty range in constraint " + s)
+		}
+		cs = append(cs, cmps)
+	}
+	return cs, nil
+}
+
+// parseComparator expands a single comparator expression into one or two
+// primitive comparators.
+func parseComparator(e string) ([]comparator, error) {
+	ms := constraintRx.FindStringSubmatch(e)
+	if ms == nil {
+		return nil, errors.New("invalid constraint " + e)
+	}
+	op, pre := ms[1], ms[5]
+
+	// n is the number of version parts present before any wildcard
+	n, vs := 0, [3]int{}
+	for i, p := range ms[2:5] {
+		if p == "" || p == "x" || p == "X" || p == "*" {
+			break
+		}
+		vs[i], _ = strconv.Atoi(p)
+		n++
+	}
+
+	ver := func(vs [3]int, pre string) version {
+		sv := semver{prefix: "v", major: vs[0], minor: vs[1], patch: vs[2]}
+		if pre != "" {
+			sv.pre = strings.Split(pre, ".")
+		}
+		return version(sv.String())
+	}
+	// next returns the lowest version above all versions matching the first
+	// i parts of vs
+	next := func(i int) version {
+		ns := [3]int{}
+		copy(ns[:i], vs[:i])
+		ns[i-1]++
+		return ver(ns, "")
+	}
+	lo := ver(vs, pre)
+
+	switch {
+	case n == 0:
+		// a wildcard matches anything
+		return []comparator{{">=", ver([3]int{}, "")}}, nil
+	case op == "^":
+		// the upper bound is the next version of the first non-zero part
+		i := 1
+		for i < n && vs[i-1] == 0 {
+			i++
+		}
+		return []comparator{{">=", lo}, {"<", next(i)}}, nil
+	case op == "~":
+		if n == 1 {
+			return []comparator{{">=", lo}, {"<", next(1)}}, nil
+		}
+		return []comparator{{">=", lo}, {"<", next(2)}}, nil
+	case n == 3:
+		if op == "" {
+			op = "="
+		}
+		return []comparator{{op, lo}}, nil
+	case op == "" || op == "=":
+		return []comparator{{">=", lo}, {"<", next(n)}}, nil
+	case op == ">":
+		return []comparator{{">=", next(n)}}, nil
+	case op == "<=":
+		return []comparator{{"<", next(n)}}, nil
+	}
+	return []comparator{{op, lo}}, nil
+}
+
+// match returns true if v satisfies the constraint.
+func (cs constraint) match(v version) bool {
+	if v.isPrerelease() && !cs.pre() {
+		return false
+	}
+	for _, r := range cs {
+		ok := true
+		for _, c := range r {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pre returns true if any comparator of the constraint has a prerelease, in
+// which case prereleases may satisfy the constraint.
+func (cs constraint) pre() bool {
+	for _, r := range cs {
+		for _, c := range r {
+			if c.v.isPrerelease() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match returns true if v satisfies the comparator.
+func (c comparator) match(v version) bool {
+	i := v.compare(c.v)
+	switch c.op {
+	case "<":
+		return i < 0
+	case "<=":
+		return i <= 0
+	case ">":
+		return i > 0
+	case ">=":
+		return i >= 0
+	}
+	return i == 0
+}
+
+// versioner sifts through a local git repo for version information.
+type versioner struct {
+	*git.Repository
+	path string
+	kind versionKind
+
+	// in tag mode, the highest version tag of each tagged commit and the
+	// highest version reachable from each commit visited, otherwise nil
+	tags map[plumbing.Hash]version
+	seen map[plumbing.Hash]version
+
+	// the tag prefix and source paths of a component, see components
+	prefix string
+	paths  []string
+}
+
+// newVersioner returns a versioner for a local git repo using the given file
+// path of the VERSION file in the repository, of the named kind or if kind is
+// empty the kind for the file name, see kindOf. The working directory must be
+// inside a git repository.
+func newVersioner(path, kind string) (versioner, error) {
+	k, err := kindOf(path, kind)
+	if err != nil {
+		return versioner{}, err
+	}
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return versioner{}, err
+	}
+	return versioner{Repository: r, path: path, kind: k}, nil
+}
+
+// versionKind is a format of version file. The find function returns the
+// start and end offsets of the version in the contents of a file, or -1 if
+// there is none. The text kind is the first line of a plain text file, and
+// the other kinds are a version field in a structured file.
+type versionKind struct {
+	name string
+	find func(string) (int, int)
+}
+
+// versionKinds are the kinds of version file by name.
+var versionKinds = map[string]versionKind{
+	"text": {"text", func(s string) (int, int) {
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			return 0, i
+		}
+		return 0, len(s)
+	}},
+	"json":      {"json", findJSON},
+	"cargo":     {"cargo", findTOML("package", "workspace.package")},
+	"pyproject": {"pyproject", findTOML("project", "tool.poetry")},
+	"chart":     {"chart", findRx(regexp.MustCompile(`(?m)^version:[ \t]*["']?([^"'\s#]+)`))},
+	"go":        {"go", findRx(regexp.MustCompile(`(?m)^\s*(?:(?:const|var)\s+)?Version(?:\s+string)?\s*=\s*"([^"]*)"`))},
+}
+
+// kindOf returns the version kind named by kind, or if kind is empty the
+// kind for the version file path: json for package.json or any .json file,
+// cargo for Cargo.toml, pyproject for pyproject.toml, chart for Chart.yaml,
+// go for any .go file, otherwise text.
+func kindOf(p, kind string) (versionKind, error) {
+	if kind != "" {
+		k, ok := versionKinds[kind]
+		if !ok {
+			return versionKind{}, fmt.Errorf("unknown version file kind %s", kind)
+		}
+		return k, nil
+	}
+
+	switch b := path.Base(p); {
+	case path.Ext(b) == ".json":
+		return versionKinds["json"], nil
+	case b == "Cargo.toml":
+		return versionKinds["cargo"], nil
+	case b == "pyproject.toml":
+		return versionKinds["pyproject"], nil
+	case b == "Chart.yaml":
+		return versionKinds["chart"], nil
+	case path.Ext(b) == ".go":
+		return versionKinds["go"], nil
+	}
+	return versionKinds["text"], nil
+}
+
+// findRx returns a find function for the first submatch of the first match
+// of rx.
+func findRx(rx *regexp.Regexp) func(string) (int, int) {
+	return func(s string) (int, int) {
+		l := rx.FindStringSubmatchIndex(s)
+		if l == nil {
+			return -1, -1
+		}
+		return l[2], l[3]
+	}
+}
+
+// findJSON finds the string value of the top-level version key of a json
+// object, ignoring version keys of nested objects such as dependencies.
+func findJSON(s string) (int, int) {
+	d := json.NewDecoder(strings.NewReader(s))
+	if t, err := d.Token(); err != nil || t != json.Delim('{') {
+		return -1, -1
+	}
+	for d.More() {
+		k, err := d.Token()
+		if err != nil {
+			return -1, -1
+		}
+		off := int(d.InputOffset())
+		if k != "version" {
+			var v json.RawMessage
+			if err := d.Decode(&v); err != nil {
+				return -1, -1
+			}
+			continue
+		}
+		if v, err := d.Token(); err != nil {
+			return -1, -1
+		} else if _, ok := v.(string); !ok {
+			return -1, -1
+		}
+		end := int(d.InputOffset())
+		return off + strings.IndexByte(s[off:end], '"') + 1, end - 1
+	}
+	return -1, -1
+}
+
+// regexps of a toml table header and a quoted version key
+var (
+	tomlTableRx   = regexp.MustCompile(`^\s*\[\s*([^\[\]\s]+)\s*\]`)
+	tomlVersionRx = regexp.MustCompile(`^\s*version\s*=\s*["']([^"']*)["']`)
+)
+
+// findTOML returns a find function for the version key of the first of the
+// toml tables which has one.
+func findTOML(tables ...string) func(string) (int, int) {
+	return func(s string) (int, int) {
+		found := map[string][2]int{}
+		var table string
+		for off := 0; off < len(s); {
+			l := s[off:]
+			if i := strings.IndexByte(l, '\n'); i >= 0 {
+				l = l[:i+1]
+			}
+			switch {
+			case strings.HasPrefix(strings.TrimSpace(l), "[["):
+				table = ""
+			case tomlTableRx.MatchString(l):
+				table = tomlTableRx.FindStringSubmatch(l)[1]
+			default:
+				m := tomlVersionRx.FindStringSubmatchIndex(l)
+				if _, ok := found[table]; m != nil && !ok {
+					found[table] = [2]int{off + m[2], off + m[3]}
+				}
+			}
+			off += len(l)
+		}
+		for _, t := range tables {
+			if l, ok := found[t]; ok {
+				return l[0], l[1]
+			}
+		}
+		return -1, -1
+	}
+}
+
+// replace returns the contents of a version file s with the version set to v.
+func (k versionKind) replace(s string, v version) (string, error) {
+	i, j := k.find(s)
+	if i < 0 {
+		return "", fmt.Errorf("no %s version field", k.name)
+	}
+	return s[:i] + v.String() + s[j:], nil
+}
+
+// regexp of a version tag, a full semver version 0.0.0-pre+build with an
+// optional v prefix, so that tags such as v1 or 2024 are not versions
+var versionTagRx = semverRx
+
+// newTagVersioner returns a versioner for a local git repo in tag mode, where
+// the version at a commit is the highest version tag reachable from it rather
+// than the value of a version file. Annotated and lightweight tags are used.
+// Only tags starting with prefix are versions, and the prefix is not part of
+// the version. The working directory must be inside a git repository.
+func newTagVersioner(prefix string) (versioner, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return versioner{}, err
+	}
+	vr := versioner{
+		Repository: r,
+		tags:       map[plumbing.Hash]version{},
+		seen:       map[plumbing.Hash]version{},
+		prefix:     prefix,
+	}
+
+	refs, err := r.Tags()
+	if err != nil {
+		return versioner{}, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		n := ref.Name().Short()
+		if !strings.HasPrefix(n, prefix) {
+			return nil
+		}
+		n = n[len(prefix):]
+		if !versionTagRx.MatchString(n) {
+			return nil
+		}
+		h := ref.Hash()
+		t, err := r.TagObject(h)
+		switch err {
+		case nil:
+			c, err := t.Commit()
+			if err != nil {
+				// a tag of something other than a commit is not a version
+				return nil
+			}
+			h = c.Hash
+		case plumbing.ErrObjectNotFound:
+		default:
+			return err
+		}
+		if v := vr.tags[h]; v == "" || v.compare(version(n)) < 0 {
+			vr.tags[h] = version(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return versioner{}, err
+	}
+	return vr, nil
+}
+
+// openVersioner returns a versioner in tag mode if tags is set, otherwise one
+// using the version file at path of the given kind. If name is not empty the versioner is for
+// that component of the repository, using its version file and tag prefix,
+// and its log and changes are of its source paths only.
+func openVersioner(path, kind string, tags bool, name string) (versioner, error) {
+	if name == "" {
+		if tags {
+			return newTagVersioner("")
+		}
+		return newVersioner(path, kind)
+	}
+
+	cs, err := loadComponents()
+	if err != nil {
+		return versioner{}, err
+	}
+	c, ok := cs[name]
+	if !ok {
+		return versioner{}, fmt.Errorf("component %s is not in %s", name, componentsFile)
+	}
+	return c.versioner(tags)
+}
+
+// the name of the components file at the root of a repository
+const componentsFile = ".hubr-components.yaml"
+
+// component is an independently versioned part of a repository, such as a
+// service in a monorepo. The version file and source paths are relative to
+// the root of the repository. Tags of the component's versions start with the
+// tag prefix.
+type component struct {
+	Name      string   `yaml:"-"`
+	Version   string   `yaml:"version"`
+	Kind      string   `yaml:"kind"`
+	Paths     []string `yaml:"paths"`
+	TagPrefix string   `yaml:"tagPrefix"`
+}
+
+// loadComponents reads the components of the repository from the components
+// file. The version file defaults to VERSION in the directory of the
+// component's name, the source paths to the directory of the version file and
+// the tag prefix to the name followed by a slash.
+func loadComponents() (map[string]component, error) {
+	dir, err := locateGitDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("locate .git: %s", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, componentsFile))
+	if err != nil {
+		return nil, fmt.Errorf("read components: %s", err)
+	}
+
+	var cfg struct {
+		Components map[string]component `yaml:"components"`
+	}
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %s", componentsFile, err)
+	}
+
+	for name, c := range cfg.Components {
+		c.Name = name
+		if c.Version == "" {
+			c.Version = path.Join(name, "VERSION")
+		}
+		if len(c.Paths) == 0 {
+			c.Paths = []string{path.Dir(c.Version)}
+		}
+		for i, p := range c.Paths {
+			c.Paths[i] = path.Clean(p)
+		}
+		if c.TagPrefix == "" {
+			c.TagPrefix = name + "/"
+		}
+		cfg.Components[name] = c
+	}
+	return cfg.Components, nil
+}
+
+// versioner returns a versioner for the component, in tag mode if tags is set.
+func (c component) versioner(tags bool) (versioner, error) {
+	var (
+		vr  versioner
+		err error
+	)
+	switch {
+	case tags:
+		vr, err = newTagVersioner(c.TagPrefix)
+	default:
+		vr, err = newVersioner(c.Version, c.Kind)
+		vr.prefix = c.TagPrefix
+	}
+	if err != nil {
+		return versioner{}, err
+	}
+	vr.paths = c.Paths
+	return vr, nil
+}
+
+// tagName returns the name of the tag of the version v, with any prefix.
+func (vr versioner) tagName(v version) string {
+	return vr.prefix + v.String()
+}
+
+// owns reports whether the file at the repository path p is in the source
+// paths of the versioner, which is every file unless it is for a component.
+func (vr versioner) owns(p string) bool {
+	if vr.paths == nil {
+		return p != ""
+	}
+	for _, s := range vr.paths {
+		if s == "." || p == s || strings.HasPrefix(p, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// touching returns the commits of cs which change a file owned by the
+// versioner, compared to their first parent.
+func (vr versioner) touching(cs []*object.Commit) ([]*object.Commit, error) {
+	if vr.paths == nil {
+		return cs, nil
+	}
+
+	ts := []*object.Commit{}
+	for _, c := range cs {
+		ct, err := c.Tree()
+		if err != nil {
+			return nil, err
+		}
+		var pt *object.Tree
+		if c.NumParents() > 0 {
+			p, err := c.Parent(0)
+			if err != nil {
+				return nil, err
+			}
+			if pt, err = p.Tree(); err != nil {
+				return nil, err
+			}
+		}
+		chs, err := object.DiffTree(pt, ct)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range chs {
+			if vr.owns(ch.From.Name) || vr.owns(ch.To.Name) {
+				ts = append(ts, c)
+				break
+			}
+		}
+	}
+	return ts, nil
+}
+
+// head returns the value of the VERSION file at HEAD.
+func (vr versioner) head() (version, error) {
+	var v version
+
+	head, err := vr.Head()
+	if err != nil {
+		return v, err
+	}
+
+	c, err := vr.CommitObject(head.Hash())
+	if err != nil {
+		return v, err
+	}
+
+	return vr.at(c)
+}
+
+// at returns the version in the VERSION file at c, or in tag mode the highest
+// version tag reachable from c.
+func (vr versioner) at(c *object.Commit) (version, error) {
+	if vr.tags != nil {
+		return vr.tagAt(c)
+	}
+
+	var v version
+
+	t, err := c.Tree()
+	if err != nil {
+		return v, err
+	}
+
+	f, err := t.File(vr.path)
+	if err == object.ErrFileNotFound {
+		return v, nil
+	}
+	if err != nil {
+		return v, err
+	}
+
+	s, err := f.Contents()
+	if err != nil {
+		return v, err
+	}
+
+	i, j := vr.kind.find(s)
+	if i < 0 {
+		return v, fmt.Errorf("%s: no %s version field", vr.path, vr.kind.name)
+	}
+	return parseVersion(s[i:j])
+}
+
+// tagAt returns the highest version tag reachable from c. The history is
+// walked once, depth first, and the version of every commit is remembered.
+func (vr versioner) tagAt(c *object.Commit) (version, error) {
+	stack := []*object.Commit{c}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		if _, ok := vr.seen[c.Hash]; ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		ps := []*object.Commit{}
+		err := c.Parents().ForEach(func(p *object.Commit) error {
+			ps = append(ps, p)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		v, ok := vr.tags[c.Hash], true
+		for _, p := range ps {
+			pv, seen := vr.seen[p.Hash]
+			if !seen {
+				stack = append(stack, p)
+				ok = false
+				continue
+			}
+			if pv != "" && (v == "" || v.compare(pv) < 0) {
+				v = pv
+			}
+		}
+		if ok {
+			vr.seen[c.Hash] = v
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return vr.seen[c.Hash], nil
+}
+
+// tag creates an annotated tag of the version v at HEAD with the message msg.
+func (vr versioner) tag(v version, msg string) error {
+	h, err := vr.Head()
+	if err != nil {
+		return err
+	}
+	sig, err := vr.signature()
+	if err != nil {
+		return err
+	}
+	_, err = vr.CreateTag(vr.tagName(v), h.Hash(), &git.CreateTagOptions{Tagger: sig, Message: msg})
+	return err
+}
+
+// signature returns the identity of the user from the environ GIT_COMMITTER_NAME
+// and GIT_COMMITTER_EMAIL, or the user section of the repository or global git
+// config.
+func (vr versioner) signature() (*object.Signature, error) {
+	sig := &object.Signature{
+		Name:  os.Getenv("GIT_COMMITTER_NAME"),
+		Email: os.Getenv("GIT_COMMITTER_EMAIL"),
+		When:  time.Now(),
+	}
+
+	if cfg, err := vr.Config(); err == nil && cfg.Raw != nil {
+		if sig.Name == "" {
+			sig.Name = cfg.Raw.Section("user").Option("name")
+		}
+		if sig.Email == "" {
+			sig.Email = cfg.Raw.Section("user").Option("email")
+		}
+	}
+
+	if f, err := os.Open(filepath.Join(os.Getenv("HOME"), ".gitconfig")); err == nil {
+		defer f.Close()
+		var c config.Config
+		if err := config.NewDecoder(f).Decode(&c); err == nil {
+			if sig.Name == "" {
+				sig.Name = c.Section("user").Option("name")
+			}
+			if sig.Email == "" {
+				sig.Email = c.Section("user").Option("email")
+			}
+		}
+	}
+
+	if sig.Name == "" || sig.Email == "" {
+		return nil, errors.New("no git user.name and user.email to tag with")
+	}
+	return sig, nil
+}
+
+// logDiff returns the additions made to the version file in the last commit,
+// or in tag mode the message of the version tag at HEAD.
+func (vr versioner) logDiff() ([]string, error) {
+	h, err := vr.Head()
+	if err != nil {
+		return []string{}, err
+	}
+	hc, err := vr.CommitObject(h.Hash())
+	if err != nil {
+		return []string{}, err
+	}
+
+	if vr.tags != nil {
+		v := vr.tags[hc.Hash]
+		if v == "" {
+			return []string{}, nil
+		}
+		ref, err := vr.Tag(vr.tagName(v))
+		if err != nil {
+			return []string{}, err
+		}
+		t, err := vr.TagObject(ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			// a lightweight tag has no message
+			return []string{}, nil
+		}
+		if err != nil {
+			return []string{}, err
+		}
+		return []string{strings.TrimSpace(t.Message)}, nil
+	}
+
+	switch hc.NumParents() {
+	case 0:
+		return []string{}, nil
+	case 1:
+	default:
+		return []string{}, errors.New("head is a merge commit; merge commits cannot be releases")
+	}
+
+	ht, err := hc.Tree()
+	if err != nil {
+		return []string{}, err
+	}
+
+	pc, err := hc.Parent(0)
+	if err != nil {
+		return []string{}, err
+	}
+
+	pt, err := pc.Tree()
+	if err != nil {
+		return []string{}, err
+	}
+
+	ss := []string{}
+	chs, err := pt.Diff(ht)
+	for _, ch := range chs {
+		p, err := ch.Patch()
+		if err != nil {
+			return []string{}, err
+		}
+		for _, fp := range p.FilePatches() {
+			if fp.IsBinary() {
+				continue
+			}
+			if _, to := fp.Files(); to.Path() != vr.path {
+				continue
+			}
+			for _, c := range fp.Chunks() {
+				if c.Type() == diff.Add {
+					ss = append(ss, c.Content())
+				}
+			}
+		}
+	}
+	return ss, nil
+}
+
+// files returns a map of files and directories that have changed since the
+// last release.
+func (vr versioner) files() (map[string]bool, error) {
+	fs := map[string]bool{}
+
+	h, err := vr.Head()
+	if err != nil {
+		return fs, fmt.Errorf("head: %s", err)
+	}
+	hc, err := vr.CommitObject(h.Hash())
+	if err != nil {
+		return fs, fmt.Errorf("head commit: %s", err)
+	}
+
+	ok, err := vr.isRelease()
+	if err != nil {
+		return fs, fmt.Errorf("head is release: %s", err)
+	}
+
+	var vbase version
+	switch ok {
+	case true:
+		pc, err := hc.Parent(0)
+		if err != nil {
+			return fs, fmt.Errorf("head commit: %s", err)
+		}
+		vbase, err = vr.at(pc)
+	default:
+		vbase, err = vr.at(hc)
+	}
+	if err != nil {
+		return fs, fmt.Errorf("base version: %s", err)
+	}
+
+	snd, rcv := passCommits()
+	snd <- hc
+
+	var cmt *object.Commit
+	for c := range rcv {
+		switch {
+		case c == nil:
+			continue
+		case c.NumParents() == 0:
+		case c.NumParents() == 1:
+			v, err := vr.at(c)
+			if err != nil {
+				return fs, fmt.Errorf("version of %s: %s", c.Hash.String(), err)
+			}
+			if v.isBefore(vbase) {
+				continue
+			}
+			p, err := c.Parent(0)
+			if err != nil {
+				return fs, fmt.Errorf("parent of %s: %s", c.Hash.String(), err)
+			}
+			snd <- p
+		default:
+			err := c.Parents().ForEach(func(c *object.Commit) error {
+				v, err := vr.at(c)
+				if err != nil {
+					return err
+				}
+				if v.isBefore(vbase) {
+					return nil
+				}
+				snd <- c
+				return nil
+			})
+			if err != nil {
+				return fs, fmt.Errorf("merge %s: %s", c.Hash.String(), err)
+			}
+		}
+		cmt = c
+	}
+
+	if cmt == nil {
+		return fs, fmt.Errorf("cant get commits. missing VERSION?")
+	}
+
+	ht, err := hc.Tree()
+	if err != nil {
+		return fs, fmt.Errorf("head tree: %s", err)
+	}
+
+	ct, err := cmt.Tree()
+	if err != nil {
+		return fs, fmt.Errorf("commit tree: %s", err)
+	}
+
+	cs, err := ht.Diff(ct)
+	if err != nil {
+		return fs, fmt.Errorf("diff: %s", err)
+	}
+
+	put := func(ss ...string) {
+		for _, s := range ss {
+			if !vr.owns(s) {
+				continue
+			}
+			fs[s] = true
+			for {
+				d := path.Dir(s)
+				if d == "." || d == "/" {
+					break
+				}
+				s = d
+				fs[s] = true
+			}
+		}
+	}
+
+	for _, c := range cs {
+		put(c.From.Name, c.To.Name)
+	}
+	return fs, nil
+}
+
+// isRelease returns true if the version has changed in the HEAD commit. In tag
+// mode it returns true if HEAD has a version tag higher than that of any
+// parent, merge commits included.
+func (vr versioner) isRelease() (bool, error) {
+	head, err := vr.Head()
+	if err != nil {
+		return false, err
+	}
+
+	hc, err := vr.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+
+	if vr.tags != nil {
+		hv := vr.tags[hc.Hash]
+		if hv == "" {
+			return false, nil
+		}
+		av, err := vr.at(hc)
+		if err != nil {
+			return false, err
+		}
+		return hv == av && !vr.tagged(hc.Parents(), hv), nil
+	}
+
+	switch hc.NumParents() {
+	case 1:
+	case 0:
+		// no parent probably counts as a kind of release
+		return true, nil
+	default:
+		// merge commits cannot be releases
+		return false, nil
+	}
+
+	hv, err := vr.at(hc)
+	if err != nil {
+		return false, err
+	}
+
+	pc, err := hc.Parent(0)
+	if err != nil {
+		return false, err
+	}
+
+	pv, err := vr.at(pc)
+	if err != nil {
+		return false, err
+	}
+
+	return hv != pv, nil
+}
+
+// tagged reports whether the version v is reachable from any of the commits
+// cs, in tag mode.
+func (vr versioner) tagged(cs object.CommitIter, v version) bool {
+	found := false
+	cs.ForEach(func(c *object.Commit) error {
+		if pv, err := vr.at(c); err == nil && pv == v {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// lastLog returns the content of the version file at HEAD, which is empty in
+// tag mode or if the version file is not text.
+func (vr versioner) lastLog() (string, error) {
+	if vr.tags != nil || vr.kind.name != "text" {
+		return "", nil
+	}
+
+	h, err := vr.Head()
+	if err != nil {
+		return "", err
+	}
+
+	c, err := vr.CommitObject(h.Hash())
+	if err != nil {
+		return "", err
+	}
+
+	t, err := c.Tree()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := t.File(vr.path)
+	if err == object.ErrFileNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return f.Contents()
+}
+
+// logHead creates a changelog from the previous release up to HEAD. The log is
+// very complicated.
+//
+// First, a mainline of commits is calculated. If a parent of a merge commit has
+// the same version as the child, it is considered mainline.
+//
+// After the mainline is calculated, the log is constructed from the commit
+// messages of the mainline up to and not including the previous release commit.
+//
+// Any branches encountered during the second traversal are tracked back to the
+// mainline and their commit messages are inserted into the log.
+func (vr versioner) logHead() ([]*object.Commit, error) {
+	h, err := vr.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := vr.CommitObject(h.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []*object.Commit
+	switch {
+	case vr.tags != nil:
+		cs, err = vr.logTags(hc)
+	default:
+		ml, err := vr.mainline(hc)
+		if err != nil {
+			return nil, err
+		}
+		cs, err = vr.logMain(hc, ml)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vr.touching(cs)
+}
+
+// logRelease creates the changelog of the release commit at HEAD, which is
+// the log of its parent as calculated by logHead, or in tag mode the log of
+// all of its parents.
+func (vr versioner) logRelease() ([]*object.Commit, error) {
+	h, err := vr.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := vr.CommitObject(h.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	if vr.tags != nil {
+		cs, err := vr.logTags(hc.Parents())
+		if err != nil {
+			return nil, err
+		}
+		// a merge release includes the merge commit itself
+		if hc.NumParents() > 1 {
+			cs = append([]*object.Commit{hc}, cs...)
+		}
+		return vr.touching(cs)
+	}
+
+	if hc.NumParents() != 1 {
+		return []*object.Commit{}, nil
+	}
+
+	pc, err := hc.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+
+	ml, err := vr.mainline(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := vr.logMain(pc, ml)
+	if err != nil {
+		return nil, err
+	}
+	return vr.touching(cs)
+}
+
+// logTags constructs a changelog in tag mode. It returns the commits reachable
+// from cs, breadth first, up to and not including any commit with a version
+// tag. cs is a commit or an object.CommitIter.
+func (vr versioner) logTags(cs interface{}) ([]*object.Commit, error) {
+	q := []*object.Commit{}
+	switch cs := cs.(type) {
+	case *object.Commit:
+		q = append(q, cs)
+	case object.CommitIter:
+		if err := cs.ForEach(func(c *object.Commit) error {
+			q = append(q, c)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	log := []*object.Commit{}
+	for len(q) > 0 {
+		c := q[0]
+		q = q[1:]
+		if seen[c.Hash] || vr.tags[c.Hash] != "" {
+			continue
+		}
+		seen[c.Hash] = true
+		log = append(log, c)
+		if err := c.Parents().ForEach(func(p *object.Commit) error {
+			q = append(q, p)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return log, nil
+}
+
+// logMain constructs a changelog starting from c along the mainline ml.  The
+// log is constructed from the commits of the mainline up to and not including
+// the previous release commit.
+//
+// Any branches encountered during the second traversal are tracked back to the
+// mainline and their commits are inserted into the log.
+func (vr versioner) logMain(c *object.Commit, ml map[plumbing.Hash]bool) ([]*object.Commit, error) {
+	snd, rcv := passCommits()
+	snd <- c
+
+	cs := []*object.Commit{}
+	for c := range rcv {
+		switch {
+		case c == nil:
+		case c.NumParents() == 0:
+			cs = append(cs, c)
+		case c.NumParents() == 1:
+			cv, err := vr.at(c)
+			if err != nil {
+				return cs, err
+			}
+			pc, err := c.Parent(0)
+			if err != nil {
+				return cs, err
+			}
+			pv, err := vr.at(pc)
+			if err != nil {
+				return cs, err
+			}
+			if cv != pv {
+				continue
+			}
+			cs = append(cs, c)
+			snd <- pc
+		default:
+			cs = append(cs, c)
+			err := c.Parents().ForEach(func(c *object.Commit) error {
+				switch {
+				case ml[c.Hash]:
+					snd <- c
+				default:
+					cs = append(cs, vr.logBranch(c, ml)...)
+				}
+				return nil
+			})
+			if err != nil {
+				return cs, err
+			}
+		}
+	}
+	return cs, nil
+}
+
+// logBranch constructs a branch changelog starting from c back to the mainline
+// ml. It returns a slice of all commits on the branch.
+func (vr versioner) logBranch(c *object.Commit, ml map[plumbing.Hash]bool) []*object.Commit {
+	snd, rcv := passCommits()
+	snd <- c
+
+	cs := []*object.Commit{}
+	for c := range rcv {
+		if c == nil {
+			continue
+		}
+
+		if ml[c.Hash] {
+			continue
+		}
+
+		cs = append(cs, c)
+
+		if c.NumParents() == 0 {
+			continue
+		}
+
+		c.Parents().ForEach(func(c *object.Commit) error {
+			snd <- c
+			return nil
+		})
+	}
+	return cs
+}
+
+// mainline traverses commits from c and returns a map of commit hashes which
+// are considered the mainline. For any merge commit encountered, its parents
+// are considered mainline if they have the same version as the child.
+// Note: doing things this way is probably not sustainable. But it's a start.
+func (vr versioner) mainline(c *object.Commit) (map[plumbing.Hash]bool, error) {
+	snd, rcv := passCommits()
+	snd <- c
+
+	ml := map[plumbing.Hash]bool{}
+	for c := range rcv {
+		if c == nil {
+			continue
+		}
+
+		if ml[c.Hash] {
+			continue
+		}
+
+		np := c.NumParents()
+		if np == 0 {
+			ml[c.Hash] = true
+			continue
+		}
+
+		cv, err := vr.at(c)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.Parents().ForEach(func(c *object.Commit) error {
+			if np > 1 {
+				pv, err := vr.at(c)
+				if err != nil {
+					return err
+				}
+				if cv != pv {
+					return nil
+				}
+			}
+
+			snd <- c
+			return nil
+		})
+		ml[c.Hash] = true
+		if err != nil {
+			return ml, err
+		}
+	}
+	return ml, nil
+}
+
+// hubr assemble! setup the subcmds and maybe invoke one.
+func main() {
+	subs := map[string]struct {
+		fn  func([]string) error
+		use string
+	}{
+		"assets":     {assets, "list release assets"},
+		"bump":       {bump, "create a new version"},
+		"cache":      {cache, "list or prune the download cache"},
+		"cat":        {cat, "print release asset contents"},
+		"components": {components, "list changed components"},
+		"get":        {get, "download release assets"},
+		"install":    {install, "install binary, zip or tarball assets"},
+		"installed":  {installed, "list installed tools"},
+		"keygen":     {keygen, "create a signing key pair"},
+		"lock":       {lock, "lock the tools of a manifest"},
+		"now":        {now, "test for a release commit"},
+		"push":       {push, "release using version file"},
+		"release":    {release, "release by tag"},
+		"resolve":    {resolve, "resolve a tag"},
+		"say":        {say, "octocat says"},
+		"sync":       {syncDir, "install the tools of a lockfile"},
+		"tags":       {tags, "list release tags"},
+		"uninstall":  {uninstall, "remove installed tools"},
+		"upgrade":    {upgrade, "upgrade installed tools"},
+		"what":       {what, "list or check file changes"},
+		"who":        {who, "get token user"},
+	}
+	flag.Usage = func() {
+		o := flag.CommandLine.Output()
+		fmt.Fprintf(o, helpMain, os.Args[0], os.Args[0])
+		fmt.Fprintln(o, "\nOptions:")
+		flag.PrintDefaults()
+		// print the subcmds in a style matching the flag package
+		fmt.Fprintln(o, "\nCommands:")
+		// this slice hides hidden/utility subs from the main help output
+		ks := []string{"assets", "bump", "cache", "cat", "components", "get",
+			"install", "installed", "keygen", "lock", "now", "push", "release",
+			"resolve", "sync", "tags", "uninstall", "upgrade", "what", "who"}
+		for _, k := range ks {
+			fmt.Fprintf(o, "  %s\n    \t%s\n", k, subs[k].use)
+		}
+		fmt.Fprintln(o)
+	}
+
+	v := flag.Bool("v", false, "print version on standard output and exit")
+	flag.IntVar(&retries, "retries", retries, "maximum `attempts` of a request with a transient error, or env HUBR_RETRIES")
+	flag.StringVar(&defaultChain, "auth", defaultChain, "auth `chain` of token sources, or env HUBR_AUTH_CHAIN")
+	flag.StringVar(&githubURL, "url", githubURL, "GitHub Enterprise Server `url` (default env HUBR_GITHUB_URL or github.com)")
+	flag.StringVar(&githubUploadURL, "upload-url", githubUploadURL, "GitHub Enterprise Server upload `url` (default env HUBR_GITHUB_UPLOAD_URL or derived from -url)")
+	q := flag.Bool("q", false, "do not report the progress of uploads and downloads")
+	flag.StringVar(&cacheDir, "cache", cacheDir, "download cache `dir`ectory, empty to disable, or env HUBR_CACHE")
+	flag.BoolVar(&offline, "offline", offline, "answer from the cache only, make no network requests, or env HUBR_OFFLINE")
+	flag.Parse()
+	if *v {
+		fmt.Println(hubr + "-" + runtime.GOOS + "-" + runtime.GOARCH)
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sub, ok := subs[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "unrecognised command: %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log.SetFlags(0)
+	prog = newMeter(os.Stderr, *q)
+	if prog.tty && !*q {
+		log.SetOutput(prog)
+	}
+	err := sub.fn(flag.Args()[1:])
+	cacheEvictSaved()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Subcmd assets lists release assets for one or more GitHub releases.
+// With no flags, assets will be listed three per line.
+// With -l, one asset per line with content type, size and label
+// If more than one identifier is provided, headings are included.
+func assets(args []string) error {
+	f := flag.NewFlagSet("assets", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	list := f.Bool("l", false, "one per line, with description")
+	jsn := f.Bool("json", false, "one json object per asset")
+	format := f.String("format", "", "print each asset using a go text/template `template`")
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 16, 8, 2, ' ', 0)
+	for _, arg := range args {
+		id, ok := parseID(arg)
+		if !ok {
+			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]")
+		}
+
+		r, err := c.GetRelease(id)
+		if err != nil {
+			return err
+		}
+		as, err := c.ListAssets(id, r)
+		if err != nil {
+			return err
+		}
+
+		id.tag = r.GetTagName()
+		if len(args) > 1 && p == nil {
+			io.WriteString(w, id.String()+":\n")
+		}
+		if id.asset == "" {
+			id.asset = "*"
+		}
+
+		i := 0
+		for _, a := range as {
+			ok, err := filepath.Match(id.asset, a.GetName())
+			if err != nil {
+				return fmt.Errorf("%s is not a valid glob pattern", id.asset)
+			}
+			if !ok {
+				continue
+			}
+			switch {
+			case p != nil:
+				if err := p(newAssetRecord(id, r, a)); err != nil {
+					return err
+				}
+			case *list:
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", a.GetName(),
+					a.GetContentType(), a.GetSize(), a.GetLabel())
+			default:
+				i++
+				n := "\t"
+				// format into 3 columns
+				if i%3 == 2 {
+					n = "\n"
+				}
+				io.WriteString(w, a.GetName()+n)
+			}
+		}
+		if p != nil {
+			continue
+		}
+		if !*list && i%3 != 2 {
+			io.WriteString(w, "\n")
+		}
+
+		if len(args) > 1 {
+			io.WriteString(w, "\n")
+		}
+	}
+
+	return w.Flush()
+}
+
+// Subcmd bump creates a new version.
+func bump(args []string) error {
+	f := flag.NewFlagSet("bump", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	latest := f.String("latest", "", "use latest release of `"+helpOrgPart+"<repo>` (default version file)")
+	vfile := f.String("v", "VERSION", "path to the version file in the repository")
+	kind := f.String("kind", "", "version file `kind`: text, json, cargo, pyproject, chart or go (default by file name)")
+	tags := f.Bool("tags", false, "use the highest version tag reachable from head instead of the version file")
+	comp := f.String("c", "", "`component` of the repository in "+componentsFile+" (default the whole repository)")
+	write := f.Bool("w", false, "write to the version file, or create an annotated tag with -tags (default stdout)")
+	nolog := f.Bool("n", false, "print the version only, not the log")
+	tmpl := f.String("template", "", "changelog `template`: plain, markdown, keepachangelog or a file (default "+changelogFile+" or plain)")
+	f.Parse(args)
+
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	inc, err := parseIncrement(f.Arg(0))
+	if err != nil {
+		log.Printf("parse version increment: %s", err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		vr   versioner
+		v    version
+		last string
+		es   = []logEntry{}
+	)
+	switch *latest {
+	case "":
+		vr, err = openVersioner(*vfile, *kind, *tags, *comp)
+		if err != nil {
+			return fmt.Errorf("open local repository: %s", err)
+		}
+		u, err := vr.head()
+		if err != nil {
+			return fmt.Errorf("get latest version: %s", err)
+		}
+		v = u
+		if *nolog && inc != autoinc {
+			break
+		}
+		cs, err := vr.logHead()
+		if err != nil {
+			return fmt.Errorf("calculate log: %s", err)
+		}
+		for _, c := range cs {
+			es = append(es, newLogEntry(c))
+		}
+		if inc == autoinc {
+			inc = conventionalIncrement(es)
+			log.Printf("bump %s", inc)
+		}
+		if *nolog {
+			break
+		}
+		s, err := vr.lastLog()
+		if err != nil {
+			return fmt.Errorf("get committed version file contents: %s", err)
+		}
+		last = s
+	default:
+		id, ok := parseID(*latest)
+		if !ok {
+			log.Printf("%s does not match "+helpOrgPart+"<repo>", *latest)
+			f.Usage()
+			os.Exit(2)
+		}
+		if inc == autoinc {
+			return errors.New("bump auto: the increment is chosen from the local log, not allowed with -latest")
+		}
+		c, err := newClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+			c = anonClient()
+		}
+		r, err := c.GetRelease(id)
+		if err != nil {
+			return err
+		}
+		u, err := parseVersion(r.GetTagName())
+		if err != nil {
+			return err
+		}
+		v = u
+		if *nolog {
+			break
+		}
+		id.tag = v.String()
+		es = []logEntry{parseLogEntry("bumped from " + id.String())}
+	}
+
+	if inc == final && !v.isPrerelease() {
+		return fmt.Errorf("bump release: %s is not a prerelease", v)
+	}
+
+	t, err := loadChangelogTemplate(*tmpl)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		t, _ = loadChangelogTemplate("plain")
+	}
+
+	prev := v
+	if v, err = v.bump(inc); err != nil {
+		return err
+	}
+	var w io.Writer
+
+	// in tag mode the log is the tag message
+	var msg bytes.Buffer
+	switch {
+	case *write && *tags:
+		w = &msg
+	case *write:
+		dir, err := locateGitDir(".")
+		if err != nil {
+			return fmt.Errorf("locate .git: %s", err)
+		}
+
+		p, k := vr.path, vr.kind
+		if vr.Repository == nil {
+			p = *vfile
+			if k, err = kindOf(p, *kind); err != nil {
+				return err
+			}
+		}
+		if k.name != "text" {
+			// the version field is updated in place and the log is printed
+			if err := writeVersion(filepath.Join(dir, p), k, v); err != nil {
+				return fmt.Errorf("write version file: %s", err)
+			}
+			w = os.Stdout
+			break
+		}
+
+		of, err := os.Create(filepath.Join(dir, p))
+		if err != nil {
+			return fmt.Errorf("write version file: %s", err)
+		}
+		defer of.Close()
+		w = of
+	default:
+		w = os.Stdout
+	}
+
+	fmt.Fprintln(w, v.String())
+	if !*nolog {
+		s, err := newChangelog(v, prev, es).render(t)
+		if err != nil {
+			return err
+		}
+		if s != "" {
+			fmt.Fprint(w, "\n", s, "\n")
+		}
+	}
+
+	if *write && last != "" {
+		fmt.Fprint(w, "\n", last)
+	}
+
+	if *write && *tags {
+		if vr.Repository == nil {
+			if vr, err = openVersioner(*vfile, *kind, *tags, *comp); err != nil {
+				return fmt.Errorf("open local repository: %s", err)
+			}
+		}
+		if err := vr.tag(v, msg.String()); err != nil {
+			return fmt.Errorf("tag %s: %s", vr.tagName(v), err)
+		}
+		fmt.Println(vr.tagName(v))
+	}
+	return nil
+}
+
+// Subcmd cache lists or empties the download cache.
+func cache(args []string) error {
+	f := flag.NewFlagSet("cache", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	max := f.String("max", "", "prune to `size` bytes, with an optional K, M, G or T suffix (default env HUBR_CACHE_MAX or 2G)")
+	jsn := f.Bool("json", false, "one json object per cached asset or api response, with ls")
+	format := f.String("format", "", "print each cached asset or api response using a go text/template `template`, with ls")
+	f.Parse(args)
+
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+	if cacheDir == "" {
+		return errors.New("the download cache is disabled")
+	}
+
+	switch f.Arg(0) {
+	case "ls":
+		p, err := newPrinter(os.Stdout, *jsn, *format)
+		if err != nil {
+			log.Print(err)
+			f.Usage()
+			os.Exit(2)
+		}
+		es, err := cacheEntries()
+		if err != nil {
+			return err
+		}
+		hs, err := cacheHTTPEntries()
+		if err != nil {
+			return err
+		}
+		es = append(es, hs...)
+		sort.SliceStable(es, func(i, j int) bool { return es[i].Used.Before(es[j].Used) })
+		w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
+		for _, e := range es {
+			if p != nil {
+				if err := p(e); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Asset, byteSize(e.Size), e.Used.UTC().Format("2006-01-02 15:04 MST"))
+		}
+		return w.Flush()
+	case "prune":
+		n := cacheMax
+		if *max != "" {
+			var err error
+			if n, err = parseSize(*max); err != nil {
+				log.Print(err)
+				f.Usage()
+				os.Exit(2)
+			}
+		}
+		return cacheEvict(n)
+	case "clear":
+		for _, d := range []string{"blobs", "keys", "http"} {
+			if err := os.RemoveAll(filepath.Join(cacheDir, d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f.Usage()
+	os.Exit(2)
+	return nil
+}
+
+// Subcmd cat downloads one or more assets and writes one at a time to stdout.
+// A distinction is made from subcmd get which is not safe to write to stdout.
+func cat(args []string) error {
+	f := flag.NewFlagSet("cat", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	keys := f.String("keys", os.Getenv("HUBR_TRUSTED_KEYS"), "trusted public keys `file` to verify signatures, or env HUBR_TRUSTED_KEYS")
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	ks, err := loadTrustedKeys(*keys)
+	if err != nil {
+		return err
+	}
+
+	d := newDowner(c, 1, ks)
+	for _, arg := range args {
+		id, _ := parseID(arg)
+		if id.asset == "" {
+			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dst>]")
+		}
+		as, err := c.GlobAssets(id)
+		if err != nil {
+			return err
+		}
+		d.queue("\x00", as)
+	}
+
+	errs := d.wait()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		return errors.New("get failed")
+	}
+
+	return nil
+}
+
+// Subcmd get downloads one or more assets to the working directory.
+func get(args []string) error {
+	f := flag.NewFlagSet("get", flag.ExitOnError)
+	dir := f.String("d", ".", "output `dir`ectory")
+	wkr := f.Int("w", workers, "number of download workers")
+	keys := f.String("keys", os.Getenv("HUBR_TRUSTED_KEYS"), "trusted public keys `file` to verify signatures, or env HUBR_TRUSTED_KEYS")
+	auto := f.Bool("auto", false, "select the single asset built for this os and arch")
+	extract := f.Bool("extract", false, "extract archives into the directory and remove them")
+	strip := f.Int("strip", 0, "remove `n` leading path components of archive entries, with -extract")
+	f.Usage = usageFor(f)
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	ks, err := loadTrustedKeys(*keys)
+	if err != nil {
+		return err
+	}
+
+	ass := []asset{}
+	d := newDowner(c, *wkr, ks)
+	for _, arg := range args {
+		id, _ := parseID(arg)
+		if *auto && id.repo != "" && id.asset == "" {
+			id.asset = "*"
+		}
+		if id.asset == "" {
+			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dest>]")
+		}
+		as, err := c.GlobAssets(id)
+		if err != nil {
+			return err
+		}
+		if *auto {
+			a, err := selectPlatform(id, as, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			as = []asset{a}
+		}
+		ass = append(ass, as...)
+		d.queue(*dir, as)
+	}
+
+	errs := d.wait()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		return errors.New("get failed")
+	}
+
+	if !*extract {
+		return nil
+	}
+	x := extraction{all: true, strip: *strip}
+	for _, a := range ass {
+		if err := extractGot(filepath.Join(*dir, a.id.dst), *dir, x); err != nil {
+			return fmt.Errorf("extract %s: %s", a.id, err)
+		}
+	}
+	return nil
+}
+
+// extractGot unpacks the downloaded archive p into dir and removes it. A
+// single compressed file is decompressed with its extension removed, or in
+// place of p if it has none, and is not executable. Anything else is left as
+// it was downloaded.
+func extractGot(p, dir string, x extraction) error {
+	var (
+		ps  []string
+		err error
+	)
+	switch t := detectContentType(p); t {
+	case "application/zip":
+		ps, err = installZip(p, dir, x)
+	case "application/x-gzip", "application/x-xz", "application/x-bzip2":
+		ps, err = installArchive(p, p, dir, t, x, 0644)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, q := range ps {
+		if q == p {
+			return nil
+		}
+	}
+	return os.Remove(p)
+}
+
+// Subcmd install downloads one or more assets and installs based on content-type.
+// For application/zip, any executables in the zip file will be installed.
+// For application/octet-stream, the file is made executable.
+// No further types are supported.
+func install(args []string) error {
+	f := flag.NewFlagSet("install", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	dir := f.String("d", ".", "install `dir`ectory")
+	wkr := f.Int("w", workers, "number of download workers")
+	keys := f.String("keys", os.Getenv("HUBR_TRUSTED_KEYS"), "trusted public keys `file` to verify signatures, or env HUBR_TRUSTED_KEYS")
+	auto := f.Bool("auto", false, "select the single asset built for this os and arch")
+	extract := f.Bool("extract", false, "extract every archive entry, not only executables")
+	strip := f.Int("strip", 0, "remove `n` leading path components of archive entries")
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	ks, err := loadTrustedKeys(*keys)
+	if err != nil {
+		return err
+	}
+
+	is := []installation{}
+	for _, arg := range args {
+		id, _ := parseID(arg)
+		if *auto && id.repo != "" && id.asset == "" {
+			id.asset = "*"
+		}
+		if id.asset == "" {
+			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dest>]")
+		}
+		is = append(is, installation{Source: id.String(), Auto: *auto, Extract: *extract, Strip: *strip})
+	}
+
+	if err := installSources(c, *wkr, ks, *dir, is); err != nil {
+		return err
+	}
+
+	old, err := loadInstalled(*dir)
+	if err != nil {
+		return err
+	}
+	return saveInstalled(*dir, mergeInstalled(old, is))
+}
+
+// Subcmd installed lists the tools recorded as installed in a directory.
+func installed(args []string) error {
+	f := flag.NewFlagSet("installed", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	dir := f.String("d", ".", "install `dir`ectory")
+	jsn := f.Bool("json", false, "one json object per installed tool")
+	format := f.String("format", "", "print each installed tool using a go text/template `template`")
+	f.Parse(args)
+
+	if f.NArg() > 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	is, err := loadInstalled(*dir)
+	if err != nil {
+		return err
+	}
+
+	if p != nil {
+		for _, in := range is {
+			if err := p(in); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
+	for _, in := range is {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", in.tool(), in.Tag, in.Source, strings.Join(in.paths(), " "))
+	}
+	return w.Flush()
+}
+
+// Subcmd components lists the components of a repository which changed since
+// their last release.
+func components(args []string) error {
+	f := flag.NewFlagSet("components", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	tags := f.Bool("tags", false, "use version tags instead of version files")
+	all := f.Bool("a", false, "list all components (default changed only)")
+	long := f.Bool("l", false, "list with details")
+	jsn := f.Bool("json", false, "one json object per component")
+	format := f.String("format", "", "print each component using a go text/template `template`")
+	f.Parse(args)
+
+	if f.NArg() > 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	cs, err := loadComponents()
+	if err != nil {
+		return err
+	}
+	ns := []string{}
+	for n := range cs {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
+	for _, n := range ns {
+		c := cs[n]
+		vr, err := c.versioner(*tags)
+		if err != nil {
+			return fmt.Errorf("open local repository: %s", err)
+		}
+		v, err := vr.head()
+		if err != nil {
+			return fmt.Errorf("%s: get version: %s", n, err)
+		}
+		rel, err := vr.isRelease()
+		if err != nil {
+			return fmt.Errorf("%s: check release commit: %s", n, err)
+		}
+		fs, err := vr.files()
+		if err != nil {
+			return fmt.Errorf("%s: %s", n, err)
+		}
+
+		r := componentRecord{
+			Name:    n,
+			Version: v.String(),
+			Tag:     vr.tagName(v),
+			Release: rel,
+			Changed: len(fs) > 0,
+			Paths:   c.Paths,
+		}
+		if !*all && !r.Changed {
+			continue
+		}
+		switch {
+		case p != nil:
+			err = p(r)
+		case *long:
+			status := "unchanged"
+			switch {
+			case r.Release:
+				status = "release"
+			case r.Changed:
+				status = "changed"
+			}
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Tag, status, strings.Join(r.Paths, " "))
+		default:
+			_, err = fmt.Fprintln(w, r.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+type componentRecord struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Tag     string   `json:"tag"`
+	Release bool     `json:"release"`
+	Changed bool     `json:"changed"`
+	Paths   []string `json:"paths"`
+}
+
+// Subcmd keygen creates an ed25519 key pair for signing release assets. The
+// private key is written to the named file and the public key to the same
+// name with a .pub extension. Existing files are not overwritten.
+func keygen(args []string) error {
+	f := flag.NewFlagSet("keygen", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	out := f.String("o", "hubr.key", "private key `file`, the public key is written to file.pub")
+	f.Parse(args)
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range []struct {
+		path, kind string
+		b          []byte
+		mode       os.FileMode
+	}{
+		{*out, "private", key, 0600},
+		{*out + ".pub", "public", pub, 0644},
+	} {
+		o, err := os.OpenFile(k.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, k.mode)
+		if err != nil {
+			return fmt.Errorf("write %s key: %s", k.kind, err)
+		}
+		fmt.Fprintf(o, "# hubr ed25519 %s key\n%s\n", k.kind, base64.StdEncoding.EncodeToString(k.b))
+		if err := o.Close(); err != nil {
+			return fmt.Errorf("write %s key: %s", k.kind, err)
+		}
+		log.Printf("%s key: %s", k.kind, k.path)
+	}
+	return nil
+}
+
+// Subcmd lock resolves the tools of a manifest into its lockfile, with the
+// exact tag, asset ids and checksums of each.
+func lock(args []string) error {
+	f := flag.NewFlagSet("lock", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	mf := f.String("f", manifestName, "manifest `file`, the lockfile has the extension .lock")
+	update := f.Bool("u", false, "resolve every tool again (default new or changed tools only)")
+	f.Parse(args)
+
+	if f.NArg() > 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	m, err := loadManifest(*mf)
+	if err != nil {
+		return err
+	}
+
+	old := []lockedTool{}
+	if !*update {
+		old, err = loadLock(lockName(*mf))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	var c *client
+	known := map[int64]string{}
+	lts := []lockedTool{}
+	for _, t := range m.Tools {
+		lt, err := t.lockedTool()
+		if err != nil {
+			return err
+		}
+
+		locked := false
+		for _, o := range old {
+			if o.same(lt) {
+				lt, locked = o, true
+				break
+			}
+		}
+		if !locked {
+			if c == nil {
+				if c, err = newClient(); err != nil {
+					fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+					c = anonClient()
+				}
+			}
+			if err := lockAssets(c, &lt, known); err != nil {
+				return err
+			}
+			log.Printf("lock %s %s", lt.Source, lt.Tag)
+		}
+		lts = append(lts, lt)
+	}
+
+	return saveLock(lockName(*mf), lts)
+}
+
+// Subcmd now checks if head is a release commit.
+func now(args []string) error {
+	f := flag.NewFlagSet("now", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	vfile := f.String("v", "VERSION", "path to the version file in the repository")
+	kind := f.String("kind", "", "version file `kind`: text, json, cargo, pyproject, chart or go (default by file name)")
+	tags := f.Bool("tags", false, "use version tags instead of the version file")
+	comp := f.String("c", "", "`component` of the repository in "+componentsFile+" (default the whole repository)")
+	f.Parse(args)
+
+	vr, err := openVersioner(*vfile, *kind, *tags, *comp)
+	if err != nil {
+		return fmt.Errorf("open local repository: %s", err)
+	}
+
+	ok, err := vr.isRelease()
+	if err != nil {
+		return fmt.Errorf("check head: %s", err)
+	}
+
+	if !ok {
+		return errors.New("not a release")
+	}
+
+	return nil
+}
+
+// Subcmd push creates a GitHub release for a release commit. Pushing is
+// idempotent. If the current commit is not a release commit, nothing happens.
+// If releases or release assets already exist, creation will nop.
+func push(args []string) error {
+	f := flag.NewFlagSet("push", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	vfile := f.String("v", "VERSION", "path to the version file in the repository")
+	kind := f.String("kind", "", "version file `kind`: text, json, cargo, pyproject, chart or go (default by file name)")
+	tags := f.Bool("tags", false, "use version tags instead of the version file")
+	comp := f.String("c", "", "`component` of the repository in "+componentsFile+" (default the whole repository)")
+	draft := f.Bool("d", false, "leave as draft; do not publish release")
+	keepd := f.Bool("f", false, "use the full file path for uploads (default basename only)")
+	wkrs := f.Int("w", workers, "number of upload workers")
+	mksums := f.Bool("sums", false, "upload a "+sumsName+" checksum manifest of the uploads")
+	sign := f.String("sign", os.Getenv("HUBR_SIGNING_KEY"), "private key `file` to sign uploads, or env HUBR_SIGNING_KEY")
+	tmpl := f.String("template", "", "release body changelog `template`: plain, markdown, keepachangelog or a file (default "+changelogFile+" or the version file log)")
+	f.Parse(args)
+
+	args = actionsArgs(f.Args(), false)
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	id, ok := parseID(args[0])
+	if !ok || id.tag != defaultTag {
+		log.Printf("failed to parse %s, does not match "+helpOrgPart+"<repo>", args[0])
+		f.Usage()
+		os.Exit(2)
+	}
+	uploads := args[1:]
+
+	vr, err := openVersioner(*vfile, *kind, *tags, *comp)
+	if err != nil {
+		return fmt.Errorf("open local repository: %s", err)
+	}
+
+	ok, err = vr.isRelease()
+	if err != nil {
+		return fmt.Errorf("check release commit: %s", err)
+	}
+	if !ok {
+		log.Print("push: nop, head is not a release commit")
+		return setOutputs("released", "false")
+	}
+
+	key, err := loadSigningKey(*sign)
+	if err != nil {
+		return err
+	}
+
+	v, err := vr.head()
+	if err != nil {
+		return fmt.Errorf("get version of head: %s", err)
+	}
+
+	h, err := vr.Head()
+	if err != nil {
+		return fmt.Errorf("get head: %s", err)
+	}
+
+	t, err := loadChangelogTemplate(*tmpl)
+	if err != nil {
+		return err
+	}
+	if t == nil && vr.tags == nil && vr.kind.name != "text" {
+		// a structured version file has no log to release
+		t, _ = loadChangelogTemplate("plain")
+	}
+
+	var body string
+	switch {
+	case t == nil:
+		chs, err := vr.logDiff()
+		if err != nil {
+			return fmt.Errorf("get changes: %s", err)
+		}
+		body = strings.Join(chs, "\n")
+	default:
+		cs, err := vr.logRelease()
+		if err != nil {
+			return fmt.Errorf("calculate log: %s", err)
+		}
+		es := []logEntry{}
+		for _, c := range cs {
+			es = append(es, newLogEntry(c))
+		}
+		var prev version
+		if len(cs) > 0 {
+			hc, err := vr.CommitObject(h.Hash())
+			if err != nil {
+				return fmt.Errorf("get head: %s", err)
+			}
+			pc, err := hc.Parent(0)
+			if err != nil {
+				return fmt.Errorf("get head parent: %s", err)
+			}
+			if prev, err = vr.at(pc); err != nil {
+				return fmt.Errorf("get previous version: %s", err)
+			}
+		}
+		if body, err = newChangelog(v, prev, es).render(t); err != nil {
+			return err
+		}
+	}
+
+	id.tag = vr.tagName(v)
+	return spec{
+		id:      id,
+		draft:   *draft,
+		pre:     v.isPrerelease(),
+		keepd:   *keepd,
+		sums:    *mksums,
+		key:     key,
+		sha:     h.Hash().String(),
+		name:    id.tag,
+		body:    body,
+		uploads: uploads,
+		wkrs:    *wkrs,
+	}.release()
+}
+
+// releaseSHA returns the commit to release the tag of id at: that of the
+// local tag, else in GitHub Actions the commit of the workflow if id is the
+// repository of the workflow, else the local head.
+func releaseSHA(id ident) (string, error) {
+	wsha := ""
+	if strings.EqualFold(id.org+"/"+id.repo, actionsEnv("GITHUB_REPOSITORY")) {
+		wsha = actionsEnv("GITHUB_SHA")
+	}
+
+	vr, err := newVersioner("", "")
+	if err != nil {
+		if wsha != "" {
+			return wsha, nil
+		}
+		return "", fmt.Errorf("open local repository: %s", err)
+	}
+	ref, err := vr.Tag(id.tag)
+	switch err {
+	case nil:
+		obj, err := vr.TagObject(ref.Hash())
+		switch err {
+		case nil:
+			return obj.Target.String(), nil
+		case plumbing.ErrObjectNotFound:
+			return ref.Hash().String(), nil
+		default:
+			return "", err
+		}
+	case plumbing.ErrObjectNotFound, git.ErrTagNotFound:
+		if wsha != "" {
+			return wsha, nil
+		}
+		h, err := vr.Head()
+		if err != nil {
+			return "", fmt.Errorf("get local head: %s", err)
+		}
+		return h.Hash().String(), nil
+	default:
+		return "", fmt.Errorf("local repository: %s", err)
+	}
+}
+
+// Subcmd release creates a GitHub release for a tag.
+// If releases or release assets already exist, creation will nop.
+func release(args []string) error {
+	f := flag.NewFlagSet("release", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	name := f.String("name", "", "release name (defaults to tag)")
+	body := f.String("body", "", "release body string, or @file, or - to read from stdin")
+	sha := f.String("sha", "", "sha of release commit (default detect from tag, env GITHUB_SHA in GitHub Actions for the repository of the workflow, or head)")
+	draft := f.Bool("d", false, "leave as draft; do not publish release")
+	keepd := f.Bool("f", false, "use the full file path for uploads (default basename only)")
+	pre := f.Bool("pre", false, "create prerelease")
+	wkrs := f.Int("w", workers, "number of upload workers")
+	mksums := f.Bool("sums", false, "upload a "+sumsName+" checksum manifest of the uploads")
+	sign := f.String("sign", os.Getenv("HUBR_SIGNING_KEY"), "private key `file` to sign uploads, or env HUBR_SIGNING_KEY")
+	f.Parse(args)
+
+	args = actionsArgs(f.Args(), true)
+	if len(args) == 0 {
+		log.Print("release one or more arguments")
+		f.Usage()
+		os.Exit(2)
+	}
+
+	id, ok := parseID(args[0])
+	if !ok || id.tag == defaultTag || id.tag == "stable" || id.tag == "edge" || isConstraint(id.tag) {
+		log.Printf("failed to parse %s, does not match "+helpOrgPart+"<repo>@<tag>", args[0])
+		f.Usage()
+		os.Exit(2)
+	}
+	uploads := args[1:]
+
+	switch {
+	case *body == "-":
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		*body = string(b)
+	case len(*body) == 0:
+	case (*body)[0] == '@':
+		b, err := ioutil.ReadFile((*body)[1:])
+		if err != nil {
+			return err
+		}
+		*body = string(b)
+	}
+
+	if *name == "" {
+		*name = id.tag
+	}
+
+	key, err := loadSigningKey(*sign)
+	if err != nil {
+		return err
+	}
+
+	if *sha == "" {
+		if *sha, err = releaseSHA(id); err != nil {
+			return err
+		}
+	}
+
+	return spec{
+		id:      id,
+		draft:   *draft,
+		pre:     *pre,
+		keepd:   *keepd,
+		sums:    *mksums,
+		key:     key,
+		sha:     *sha,
+		name:    *name,
+		body:    *body,
+		uploads: uploads,
+		wkrs:    *wkrs,
+	}.release()
+}
+
+// Subcmd resolve resolves release tags.
+func resolve(args []string) error {
+	f := flag.NewFlagSet("resolve", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	w := f.Bool("w", false, "print web urls")
+	jsn := f.Bool("json", false, "one json object per release")
+	format := f.String("format", "", "print each release using a go text/template `template`")
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	for _, arg := range args {
+		id, ok := parseID(arg)
+		if !ok {
+			return fmt.Errorf("failed to parse %s, does not match "+helpOrgPart+"<repo>[@<tag>]", f.Arg(0))
+		}
+
+		r, err := c.GetRelease(id)
+		if err != nil {
+			return fmt.Errorf("%s: %s", arg, err)
+		}
+		id.tag = r.GetTagName()
+		switch {
+		case p != nil:
+			if err := p(newTagRecord(id, id.tag, r)); err != nil {
+				return err
+			}
+		case *w:
+			fmt.Println(r.GetHTMLURL())
+		default:
+			fmt.Println(id)
+		}
+	}
+	return nil
+}
+
+// Subcmd say is a mystery, who knows what it truly does...
+func say(args []string) error {
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+	octolog(c, strings.Join(args, " "))
+	return nil
+}
+
+// Subcmd sync installs the tools of a lockfile into a directory, downloading
+// only those which are not installed at the locked tag.
+func syncDir(args []string) error {
+	f := flag.NewFlagSet("sync", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	mf := f.String("f", manifestName, "manifest `file`, the lockfile has the extension .lock")
+	dir := f.String("d", ".", "install `dir`ectory")
+	wkr := f.Int("w", workers, "number of download workers")
+	keys := f.String("keys", os.Getenv("HUBR_TRUSTED_KEYS"), "trusted public keys `file` to verify signatures, or env HUBR_TRUSTED_KEYS")
+	n := f.Bool("n", false, "list the tools to sync without syncing")
+	prune := f.Bool("prune", false, "uninstall tools which are not in the lockfile")
+	f.Parse(args)
+
+	if f.NArg() > 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	lts, err := loadLock(lockName(*mf))
+	if err != nil {
+		return err
+	}
+
+	if err := checkLock(*mf, lts); err != nil {
+		return err
+	}
+
+	is, err := loadInstalled(*dir)
+	if err != nil {
+		return err
+	}
+
+	stale := []installation{}
+	srcs := map[string]bool{}
+	for _, lt := range lts {
+		srcs[lt.Source] = true
+		synced := false
+		for _, in := range is {
+			synced = synced || lt.synced(*dir, in)
+		}
+		if synced {
+			continue
+		}
+		if *n {
+			fmt.Printf("%s\t%s\n", lt.Source, lt.Tag)
+			continue
+		}
+		stale = append(stale, lt.installation())
+	}
+
+	keep := []installation{}
+	kept := []string{}
+	for _, in := range is {
+		switch {
+		case !*prune || srcs[in.Source]:
+			keep = append(keep, in)
+		case *n:
+			fmt.Printf("%s\tremove\n", in.Source)
+		default:
+			ds, err := in.remove(*dir)
+			if err != nil {
+				return err
+			}
+			kept = append(kept, ds...)
+		}
+	}
+	if *n {
+		return nil
+	}
+	adoptDirs(keep, kept)
+
+	if len(stale) > 0 {
+		c, err := newClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+			c = anonClient()
+		}
+		ks, err := loadTrustedKeys(*keys)
+		if err != nil {
+			return err
+		}
+		if err := installSources(c, *wkr, ks, *dir, stale); err != nil {
+			return err
+		}
+		if err := removeStale(*dir, keep, stale); err != nil {
+			return err
+		}
+	}
+	return saveInstalled(*dir, mergeInstalled(keep, stale))
+}
+
+// Subcmd tags lists tags for a repo. By default only full release tags are listed.
+// With the -a flag, prereleases, draft releases, annotated and lightweight tags are
+// also printed.
+// With the -l flag, tags a printed one per line with additional information.
+func tags(args []string) error {
+	f := flag.NewFlagSet("tags", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	list := f.Bool("l", false, "one per line, with description")
+	all := f.Bool("a", false, "list all including draft, pre-release and unreleased tags")
+	la := f.Bool("la", false, "shorthand for -l -a")
+	jsn := f.Bool("json", false, "one json object per tag")
+	format := f.String("format", "", "print each tag using a go text/template `template`")
+	f.Parse(args)
+
+	args, err := readArgs(f.Args())
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		log.Print("tags requires at least one argument")
+		f.Usage()
+		os.Exit(2)
+	}
+
+	if *la {
+		*list, *all = true, true
+	}
+
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
+		f.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
+	for _, arg := range args {
+		id, ok := parseID(arg)
+		if !ok {
+			return fmt.Errorf("failed to parse %s, does not match "+helpOrgPart+"<repo>", f.Arg(0))
+		}
+
+		// get the releases, map them by tag, then get all the tags
+		rs, err := c.ListReleases(id)
+		if err != nil {
+			return err
+		}
+		m := make(map[string]*github.RepositoryRelease, len(rs))
+		for _, r := range rs {
+			m[r.GetTagName()] = r
+		}
+		ts, err := c.ListTags(id)
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 1 && p == nil {
+			// headings for multiple args
+			io.WriteString(w, id.String()+":\n")
+		}
+
+		i := 0
+		for _, t := range ts {
+			r, ok := m[t]
+			switch {
+			case !*all && (!ok || r.GetDraft() || r.GetPrerelease()):
+				continue
+			case p != nil:
+				if err := p(newTagRecord(id, t, r)); err != nil {
+					return err
+				}
+			case *list && ok:
+				io.WriteString(w, r.GetTagName()+"\trelease\t"+r.GetCreatedAt().Format("2006-01-02 15:04 MST"))
+				if r.GetPrerelease() {
+					io.WriteString(w, "\tpre-release")
+				}
+				if r.GetDraft() {
+					io.WriteString(w, "\tdraft")
+				}
+				io.WriteString(w, "\n")
+			case *list && *all:
+				io.WriteString(w, t+"\ttag\n")
+			default:
+				n := "\t"
+				if i%5 == 4 {
 					n = "\n"
 				}
-				io.WriteString(w, a.GetName()+n)
+				io.WriteString(w, t+n)
+				i++
 			}
 		}
-		if !*list && i%3 != 2 {
+		if p != nil {
+			continue
+		}
+		if i%5 != 0 {
 			io.WriteString(w, "\n")
 		}
-
 		if len(args) > 1 {
 			io.WriteString(w, "\n")
 		}
 	}
-
-	return w.Flush()
+	return w.Flush()
+}
+
+// Subcmd uninstall removes installed tools and their record from a directory.
+func uninstall(args []string) error {
+	f := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	dir := f.String("d", ".", "install `dir`ectory")
+	f.Parse(args)
+
+	if f.NArg() == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	is, err := loadInstalled(*dir)
+	if err != nil {
+		return err
+	}
+
+	for _, tool := range f.Args() {
+		found := false
+		keep := []installation{}
+		kept := []string{}
+		for _, in := range is {
+			if !in.matches(tool) {
+				keep = append(keep, in)
+				continue
+			}
+			found = true
+			ds, err := in.remove(*dir)
+			if err != nil {
+				return err
+			}
+			kept = append(kept, ds...)
+		}
+		if !found {
+			return fmt.Errorf("%s is not installed in %s", tool, *dir)
+		}
+		adoptDirs(keep, kept)
+		is = keep
+	}
+
+	return saveInstalled(*dir, is)
+}
+
+// Subcmd upgrade re-resolves the tag of installed tools and reinstalls
+// those with a new release. Files no longer part of a tool are removed.
+func upgrade(args []string) error {
+	f := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	f.Usage = usageFor(f)
+	dir := f.String("d", ".", "install `dir`ectory")
+	wkr := f.Int("w", workers, "number of download workers")
+	keys := f.String("keys", os.Getenv("HUBR_TRUSTED_KEYS"), "trusted public keys `file` to verify signatures, or env HUBR_TRUSTED_KEYS")
+	n := f.Bool("n", false, "list stale tools without upgrading")
+	f.Parse(args)
+
+	is, err := loadInstalled(*dir)
+	if err != nil {
+		return err
+	}
+
+	for _, tool := range f.Args() {
+		found := false
+		for _, in := range is {
+			found = found || in.matches(tool)
+		}
+		if !found {
+			return fmt.Errorf("%s is not installed in %s", tool, *dir)
+		}
+	}
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
+		c = anonClient()
+	}
+
+	ks, err := loadTrustedKeys(*keys)
+	if err != nil {
+		return err
+	}
+
+	stale := []installation{}
+	for _, in := range is {
+		if f.NArg() > 0 {
+			match := false
+			for _, tool := range f.Args() {
+				match = match || in.matches(tool)
+			}
+			if !match {
+				continue
+			}
+		}
+
+		id, ok := parseID(in.Source)
+		if !ok {
+			return fmt.Errorf("%s: failed to parse recorded source", in.Source)
+		}
+		r, err := c.GetRelease(id)
+		if err != nil {
+			return fmt.Errorf("%s: %s", in.Source, err)
+		}
+		if r.GetTagName() == in.Tag {
+			continue
+		}
+
+		if *n {
+			fmt.Printf("%s\t%s -> %s\n", in.tool(), in.Tag, r.GetTagName())
+			continue
+		}
+		stale = append(stale, installation{Source: in.Source, Mode: in.Mode, Auto: in.Auto, Extract: in.Extract, Strip: in.Strip})
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if err := installSources(c, *wkr, ks, *dir, stale); err != nil {
+		return err
+	}
+	if err := removeStale(*dir, is, stale); err != nil {
+		return err
+	}
+	return saveInstalled(*dir, mergeInstalled(is, stale))
+}
+
+// Subcmd what lists the files that have changed or checks if named files have
+// changed since the previous release commit.
+func what(args []string) error {
+	f := flag.NewFlagSet("what", flag.ExitOnError)
+	vfile := f.String("v", "VERSION", "path to the version file in the repository")
+	kind := f.String("kind", "", "version file `kind`: text, json, cargo, pyproject, chart or go (default by file name)")
+	tags := f.Bool("tags", false, "use version tags instead of the version file")
+	comp := f.String("c", "", "`component` of the repository in "+componentsFile+" (default the whole repository)")
+	all := f.Bool("all", false, "return success if all named files changed (default any)")
+	f.Usage = usageFor(f)
+	f.Parse(args)
+
+	vr, err := openVersioner(*vfile, *kind, *tags, *comp)
+	if err != nil {
+		return fmt.Errorf("open local repository: %s", err)
+	}
+
+	fs, err := vr.files()
+	if err != nil {
+		return err
+	}
+
+	if f.NArg() == 0 {
+		ss := []string{}
+		for s := range fs {
+			ss = append(ss, s)
+		}
+		sort.Strings(ss)
+		for _, s := range ss {
+			fmt.Println(s)
+		}
+		return nil
+	}
+
+	nc := []string{}
+	for _, arg := range f.Args() {
+		p := path.Clean(arg)
+		if *all {
+			if !fs[p] {
+				nc = append(nc, p)
+			}
+			continue
+		}
+		if fs[p] {
+			return nil
+		}
+	}
+	if !*all {
+		return errors.New("no changes detected")
+	}
+	if len(nc) > 0 {
+		return errors.New("no changes detected: " + strings.Join(nc, ", "))
+	}
+	return nil
 }
 
-// Subcmd bump creates a new version.
-func bump(args []string) error {
-	f := flag.NewFlagSet("bump", flag.ExitOnError)
+// Subcmd who prints the owner of the GitHub personal access token used by hubr.
+func who(args []string) error {
+	f := flag.NewFlagSet("who", flag.ExitOnError)
 	f.Usage = usageFor(f)
-	latest := f.String("latest", "", "use latest release of `"+helpOrgPart+"<repo>` (default version file)")
-	vfile := f.String("v", "VERSION", "path to the version file in the repository")
-	write := f.Bool("w", false, "write to the version file (default stdout)")
-	nolog := f.Bool("n", false, "print the version only, not the log")
+	jsn := f.Bool("json", false, "print a json object")
+	format := f.String("format", "", "print the user using a go text/template `template`")
 	f.Parse(args)
 
-	if f.NArg() != 1 {
+	p, err := newPrinter(os.Stdout, *jsn, *format)
+	if err != nil {
+		log.Print(err)
 		f.Usage()
 		os.Exit(2)
 	}
 
-	inc, err := parseIncrement(f.Arg(0))
+	c, err := newClient()
 	if err != nil {
-		log.Printf("parse version increment: %s", err)
-		f.Usage()
-		os.Exit(2)
+		return err
+	}
+	u, _, err := c.Users.Get(ctxbg, "")
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return p(userRecord{u.GetLogin(), u.GetName(), u.GetHTMLURL()})
 	}
+	fmt.Println(u.GetLogin())
+	return nil
+}
 
-	var (
-		v    version
-		last string
-		msgs = []string{}
-	)
-	switch *latest {
-	case "":
-		vr, err := newVersioner(*vfile)
-		if err != nil {
-			return fmt.Errorf("open local repository: %s", err)
-		}
-		u, err := vr.head()
-		if err != nil {
-			return fmt.Errorf("get latest version: %s", err)
-		}
-		v = u
-		if *nolog {
-			break
-		}
-		ss, err := vr.logHead()
-		if err != nil {
-			return fmt.Errorf("calculate log: %s", err)
-		}
-		msgs = ss
-		s, err := vr.lastLog()
-		if err != nil {
-			return fmt.Errorf("get committed version file contents: %s", err)
-		}
-		last = s
-	default:
-		id, ok := parseID(*latest)
-		if !ok {
-			log.Printf("%s does not match "+helpOrgPart+"<repo>", *latest)
-			f.Usage()
-			os.Exit(2)
-		}
-		c, err := newClient()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-			c = &client{Client: github.NewClient(nil)}
-		}
-		r, err := c.GetRelease(id)
+// detectContentType determines the mime type of the file at path.
+// xz and bzip2 are detected in addition to the types known to net/http.
+func detectContentType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	b := make([]byte, 512)
+	n, err := f.Read(b)
+	if err != nil {
+		return ""
+	}
+	b = b[:n]
+
+	switch {
+	case bytes.HasPrefix(b, []byte("\xfd7zXZ\x00")):
+		return "application/x-xz"
+	case bytes.HasPrefix(b, []byte("BZh")):
+		return "application/x-bzip2"
+	}
+
+	return http.DetectContentType(b)
+}
+
+// credHelper attempts to invoke a git credential helper by parsing git config
+// first in a local repository if present and then in the home directory.
+// if anything goes wrong it returns an empty string.
+func credHelper() string {
+	find := func(p string) string {
+		f, err := os.Open(p)
 		if err != nil {
-			return err
+			return ""
 		}
-		u, err := parseVersion(r.GetTagName())
-		if err != nil {
-			return err
+		defer f.Close()
+		var c config.Config
+		if err := config.NewDecoder(f).Decode(&c); err != nil {
+			return ""
 		}
-		v = u
-		if *nolog {
-			break
+		for _, s := range c.Sections {
+			if s.Name != "credential" {
+				continue
+			}
+			for _, o := range s.Options {
+				if o.Key == "helper" {
+					return o.Value
+				}
+			}
 		}
-		id.tag = v.String()
-		msgs = []string{"bumped from " + id.String()}
+		return ""
 	}
 
-	v = v.bump(inc)
-	var w io.Writer
+	var h string
+	d, err := locateGitDir(".")
+	if err == nil {
+		h = find(filepath.Join(d, ".git", "config"))
+	}
+	if h == "" {
+		h = find(filepath.Join(os.Getenv("HOME"), ".gitconfig"))
+	}
+	if h == "" {
+		return ""
+	}
 
-	switch {
-	case *write:
-		dir, err := locateGitDir(".")
-		if err != nil {
-			return fmt.Errorf("locate .git: %s", err)
+	// see https://git-scm.com/docs/gitcredentials#gitcredentials-helper
+	if h[0] != filepath.Separator {
+		h = "git credential-" + h
+	}
+	h = h + " get"
+
+	// using sh seems to be the easiest way to deal with the helper string
+	// without having to split the args
+	r, w := io.Pipe()
+	cmd := exec.Command("/bin/sh", "-c", h)
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + githubHost() + "\n")
+	cmd.Stdout = w
+	if err := cmd.Start(); err != nil {
+		return ""
+	}
+
+	done := make(chan error)
+	var t string
+	s := bufio.NewScanner(r)
+
+	go func() { done <- cmd.Wait() }()
+	go func() {
+		for s.Scan() {
+			p := strings.Split(s.Text(), "=")
+			if len(p) != 2 {
+				continue
+			}
+			if p[0] == "password" {
+				t = p[1]
+				done <- nil
+			}
 		}
+	}()
 
-		of, err := os.Create(filepath.Join(dir, *vfile))
+	select {
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		// i really don't like printing here, but i don't want to add err return
+		fmt.Fprintln(os.Stderr, "cred helper timeout: 5sec")
+		return ""
+	case err := <-done:
 		if err != nil {
-			return fmt.Errorf("write version file: %s", err)
+			// as above, it's not right printing this deep
+			fmt.Fprintf(os.Stderr, "error from cred helper: %v\n", err)
+			return ""
 		}
-		defer of.Close()
-		w = of
-	default:
-		w = os.Stdout
 	}
 
-	fmt.Fprintln(w, v.String())
-	if *nolog {
-		return nil
+	return t
+}
+
+// detectExecutable detects if the file at path is a pe, mach-o or elf executable.
+func detectExecutable(path string) string {
+	pf, err := pe.Open(path)
+	if err == nil {
+		pf.Close()
+		return "windows"
 	}
 
-	if len(msgs) > 0 {
-		fmt.Fprintln(w)
-		for _, msg := range msgs {
-			b := "- "
-			for _, l := range strings.Split(msg, "\n") {
-				if l == "" {
-					continue
-				}
-				fmt.Fprintln(w, b+l)
-				b = "  "
-			}
-		}
-		fmt.Fprintln(w)
+	mf, err := macho.Open(path)
+	if err == nil && mf.FileHeader.Type == macho.TypeExec {
+		mf.Close()
+		return "darwin"
 	}
 
-	if *write && last != "" {
-		fmt.Fprint(w, "\n", last)
+	ef, err := elf.Open(path)
+	if err == nil && ef.FileHeader.Type == elf.ET_EXEC {
+		ef.Close()
+		return "linux"
 	}
-	return nil
-}
 
-// Subcmd cat downloads one or more assets and writes one at a time to stdout.
-// A distinction is made from subcmd get which is not safe to write to stdout.
-func cat(args []string) error {
-	f := flag.NewFlagSet("cat", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	f.Parse(args)
+	return ""
+}
 
-	args, err := readArgs(f.Args())
-	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
+// platform aliases as they commonly appear in asset names, keyed by GOOS or GOARCH
+var (
+	osAliases = map[string][]string{
+		"darwin":  {"darwin", "macos", "osx", "mac", "apple"},
+		"linux":   {"linux"},
+		"windows": {"windows", "win", "win32", "win64", "exe"},
+		"freebsd": {"freebsd"},
+		"openbsd": {"openbsd"},
+		"netbsd":  {"netbsd"},
+	}
+	archAliases = map[string][]string{
+		"amd64": {"amd64", "x64", "64bit"},
+		"386":   {"386", "i386", "i686", "x86", "32bit"},
+		"arm64": {"arm64", "aarch64"},
+		"arm":   {"arm", "armv6", "armv6l", "armv7", "armv7l", "armhf"},
 	}
+)
 
-	if len(args) == 0 {
-		f.Usage()
-		os.Exit(2)
-	}
+// selectPlatform picks the single asset in as built for goos and goarch by
+// matching its name against osAliases and archAliases. An asset naming the os
+// and arch is preferred to one naming only the os, as with a universal build.
+// Checksum and signature assets are never selected. It is an error if no asset
+// matches or if several match equally well.
+func selectPlatform(id ident, as []asset, goos, goarch string) (asset, error) {
+	score := func(name string) int {
+		n := strings.ToLower(name)
+		// x86_64 would otherwise split into unrelated tokens
+		n = strings.NewReplacer("x86_64", "amd64", "x86-64", "amd64").Replace(n)
+		ts := map[string]bool{}
+		for _, t := range strings.FieldsFunc(n, func(r rune) bool {
+			return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+		}) {
+			ts[t] = true
+		}
+		has := func(aliases []string) bool {
+			for _, a := range aliases {
+				if ts[a] {
+					return true
+				}
+			}
+			return false
+		}
 
-	c, err := newClient()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+		if !has(osAliases[goos]) {
+			return 0
+		}
+		for arch, aliases := range archAliases {
+			if arch != goarch && has(aliases) && !has(archAliases[goarch]) {
+				return 0
+			}
+		}
+		if has(archAliases[goarch]) {
+			return 2
+		}
+		return 1
 	}
 
-	d := newDowner(c, 1)
-	for _, arg := range args {
-		id, _ := parseID(arg)
-		if id.asset == "" {
-			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dst>]")
+	best := 0
+	var cs []asset
+	for _, a := range as {
+		n := a.GetName()
+		if n == sumsName || strings.HasSuffix(n, sigExt) ||
+			strings.HasSuffix(n, ".sha256") || strings.HasSuffix(n, ".asc") {
+			continue
 		}
-		as, err := c.GlobAssets(id)
-		if err != nil {
-			return err
+		switch sc := score(n); {
+		case sc == 0 || sc < best:
+		case sc > best:
+			best = sc
+			cs = []asset{a}
+		default:
+			cs = append(cs, a)
 		}
-		d.queue("\x00", as)
 	}
 
-	errs := d.wait()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			log.Print(err)
+	names := func(as []asset) string {
+		ns := make([]string, len(as))
+		for i, a := range as {
+			ns[i] = a.GetName()
 		}
-		return errors.New("get failed")
+		return strings.Join(ns, ", ")
+	}
+	switch len(cs) {
+	case 0:
+		return asset{}, fmt.Errorf("%s: no asset for %s/%s in: %s", id, goos, goarch, names(as))
+	case 1:
+		return cs[0], nil
+	default:
+		return asset{}, fmt.Errorf("%s: %d assets for %s/%s, narrow the glob to one of: %s", id, len(cs), goos, goarch, names(cs))
 	}
+}
 
-	return nil
+// installedName is the file in an install directory recording its installations.
+const installedName = ".hubr-installed.json"
+
+// installation records the assets installed into a directory from one source
+// ident. The source keeps the unresolved tag so an upgrade can resolve it again.
+// The mode is empty to install executables, or get to install assets as they
+// are downloaded. The dirs are the directories made by extracting archives,
+// relative to the install directory, which are removed with the installation
+// once empty.
+type installation struct {
+	Source    string           `json:"source"`
+	Mode      string           `json:"mode,omitempty"`
+	Auto      bool             `json:"auto,omitempty"`
+	Extract   bool             `json:"extract,omitempty"`
+	Strip     int              `json:"strip,omitempty"`
+	Tag       string           `json:"tag"`
+	Assets    []installedAsset `json:"assets"`
+	Dirs      []string         `json:"dirs,omitempty"`
+	Installed time.Time        `json:"installed"`
 }
 
-// Subcmd get downloads one or more assets to the working directory.
-func get(args []string) error {
-	f := flag.NewFlagSet("get", flag.ExitOnError)
-	dir := f.String("d", ".", "output `dir`ectory")
-	wkr := f.Int("w", workers, "number of download workers")
-	f.Usage = usageFor(f)
-	f.Parse(args)
+// installedAsset is a release asset and the files installed from it,
+// the paths are relative to the install directory.
+type installedAsset struct {
+	Name   string   `json:"name"`
+	ID     int64    `json:"id"`
+	SHA256 string   `json:"sha256"`
+	Paths  []string `json:"paths"`
+}
 
-	args, err := readArgs(f.Args())
-	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
-	}
+// tool is the name of an installation, the repo of its source.
+func (in installation) tool() string {
+	id, _ := parseID(in.Source)
+	return id.repo
+}
 
-	if len(args) == 0 {
-		f.Usage()
-		os.Exit(2)
-	}
+// extraction selects the archive entries of the installation.
+func (in installation) extraction() extraction {
+	return extraction{in.Extract, in.Strip}
+}
 
-	c, err := newClient()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+// paths lists the files of every asset of the installation.
+func (in installation) paths() []string {
+	ps := []string{}
+	for _, a := range in.Assets {
+		ps = append(ps, a.Paths...)
 	}
+	return ps
+}
 
-	d := newDowner(c, *wkr)
-	for _, arg := range args {
-		id, _ := parseID(arg)
-		if id.asset == "" {
-			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dest>]")
-		}
-		as, err := c.GlobAssets(id)
-		if err != nil {
-			return err
+// remove removes the files of the installation from dir, logging each, then
+// its directories which are left empty. It returns the directories which are
+// kept as they are not empty.
+func (in installation) remove(dir string) ([]string, error) {
+	for _, p := range in.paths() {
+		dst := filepath.Join(dir, p)
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return nil, err
 		}
-		d.queue(*dir, as)
+		log.Printf("  %s", dst)
 	}
+	return removeDirs(dir, in.Dirs), nil
+}
 
-	errs := d.wait()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			log.Print(err)
+// removeDirs removes the directories ds of dir which are empty, deepest
+// first, and returns those which are kept. A directory which is not empty,
+// such as one shared with another installation, is kept.
+func removeDirs(dir string, ds []string) []string {
+	ds = append([]string{}, ds...)
+	sort.Slice(ds, func(i, j int) bool { return len(ds[i]) > len(ds[j]) })
+	kept := []string{}
+	for _, d := range ds {
+		err := os.Remove(filepath.Join(dir, d))
+		if err != nil && !os.IsNotExist(err) {
+			kept = append(kept, d)
 		}
-		return errors.New("get failed")
 	}
+	return kept
+}
 
-	return nil
+// adoptDirs records the directories ds, kept after removing an installation,
+// with the installations of is which have files in them, so that they are
+// removed with the last of those installations.
+func adoptDirs(is []installation, ds []string) {
+	for i := range is {
+		for _, d := range ds {
+			for _, p := range is[i].paths() {
+				if strings.HasPrefix(p, d+string(filepath.Separator)) {
+					is[i].Dirs = mergeDirs(is[i].Dirs, []string{d})
+					break
+				}
+			}
+		}
+	}
 }
 
-// Subcmd install downloads one or more assets and installs based on content-type.
-// For application/zip, any executables in the zip file will be installed.
-// For application/octet-stream, the file is made executable.
-// No further types are supported.
-func install(args []string) error {
-	f := flag.NewFlagSet("install", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	dir := f.String("d", ".", "install `dir`ectory")
-	wkr := f.Int("w", workers, "number of download workers")
-	f.Parse(args)
+// matches reports whether tool names the installation by repo, org/repo or
+// the name of an installed file.
+func (in installation) matches(tool string) bool {
+	id, _ := parseID(in.Source)
+	if tool == id.repo || tool == id.org+"/"+id.repo {
+		return true
+	}
+	for _, p := range in.paths() {
+		if tool == p || tool == filepath.Base(p) {
+			return true
+		}
+	}
+	return false
+}
 
-	args, err := readArgs(f.Args())
+// loadInstalled reads the installations recorded in dir.
+// A directory without a record has no installations.
+func loadInstalled(dir string) ([]installation, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, installedName))
+	if os.IsNotExist(err) {
+		return []installation{}, nil
+	}
 	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
+		return nil, err
 	}
+	is := []installation{}
+	if err := json.Unmarshal(b, &is); err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Join(dir, installedName), err)
+	}
+	return is, nil
+}
 
-	if len(args) == 0 {
-		f.Usage()
-		os.Exit(2)
+// saveInstalled replaces the installations recorded in dir.
+func saveInstalled(dir string, is []installation) error {
+	sort.Slice(is, func(i, j int) bool { return is[i].Source < is[j].Source })
+	b, err := json.MarshalIndent(is, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	c, err := newClient()
+	f, err := ioutil.TempFile(dir, "."+installedName+".hubr-")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+		return err
 	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	// setup a temp directory for install operations
-	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("hubr-%d", time.Now().Unix()))
-	if err := os.MkdirAll(tmp, 0755); err != nil {
-		return fmt.Errorf("failed to create dir in %s: %s", os.TempDir(), err)
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
 	}
-	defer os.RemoveAll(tmp)
+	return commitFile(f, filepath.Join(dir, installedName), 0644)
+}
 
-	ass := []asset{}
-	d := newDowner(c, *wkr)
-	for _, arg := range args {
-		id, _ := parseID(arg)
-		if id.asset == "" {
-			return errors.New("failed to parse " + arg + ", does not match " + helpOrgPart + "<repo>[@<tag>]:<asset>[:<dest>]")
+// mergeInstalled records the installations in is over those in old. An old
+// installation of the same source is replaced, keeping its directories, and
+// files now belonging to a new installation are dropped from any other.
+func mergeInstalled(old, is []installation) []installation {
+	owned := map[string]bool{}
+	srcs := map[string]int{}
+	for i, in := range is {
+		srcs[in.Source] = i + 1
+		for _, p := range in.paths() {
+			owned[p] = true
 		}
+	}
 
-		as, err := c.GlobAssets(id)
-		if err != nil {
-			return err
+	merged := append([]installation{}, is...)
+	for _, in := range old {
+		if i := srcs[in.Source]; i > 0 {
+			merged[i-1].Dirs = mergeDirs(merged[i-1].Dirs, in.Dirs)
+			continue
+		}
+		as := []installedAsset{}
+		for _, a := range in.Assets {
+			ps := []string{}
+			for _, p := range a.Paths {
+				if !owned[p] {
+					ps = append(ps, p)
+				}
+			}
+			if len(ps) > 0 {
+				a.Paths = ps
+				as = append(as, a)
+			}
+		}
+		if len(as) > 0 {
+			in.Assets = as
+			merged = append(merged, in)
 		}
-
-		ass = append(ass, as...)
-		d.queue(tmp, as)
 	}
+	return merged
+}
 
-	errs := d.wait()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			log.Print(err)
+// mergeDirs returns the directories of ds and more, without duplicates.
+func mergeDirs(ds, more []string) []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, d := range append(append([]string{}, ds...), more...) {
+		if !seen[d] {
+			seen[d] = true
+			r = append(r, d)
 		}
-		return errors.New("download failed")
 	}
+	sort.Strings(r)
+	if len(r) == 0 {
+		return nil
+	}
+	return r
+}
 
-	for _, a := range ass {
-		src := filepath.Join(tmp, a.id.dst)
-		dst := filepath.Join(*dir, a.id.dst)
-
-		t := detectContentType(src)
-		if t != a.GetContentType() {
-			log.Printf("warning: content type mismatch: detected %s, github reported %s", t, a.GetContentType())
-		}
-		switch t {
-		case "application/octet-stream":
-			err = installBin(src, dst)
-		case "application/zip":
-			err = installZip(src, *dir)
-		default:
-			return fmt.Errorf("unsupported content type: %s", a.GetContentType())
+// removeStale removes the files of the old installations which a new
+// installation of the same source no longer provides, and their directories
+// which are left empty.
+func removeStale(dir string, old, is []installation) error {
+	for _, in := range is {
+		ps := map[string]bool{}
+		for _, p := range in.paths() {
+			ps[p] = true
 		}
-		if err != nil {
-			return err
+		for _, o := range old {
+			if o.Source != in.Source {
+				continue
+			}
+			for _, p := range o.paths() {
+				if ps[p] {
+					continue
+				}
+				if err := os.Remove(filepath.Join(dir, p)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			removeDirs(dir, o.Dirs)
 		}
 	}
-
 	return nil
 }
 
-// Subcmd now checks if head is a release commit.
-func now(args []string) error {
-	f := flag.NewFlagSet("now", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	vfile := f.String("v", "VERSION", "path to the version file in the repository")
-	f.Parse(args)
+// the default manifest of tools for lock and sync
+const manifestName = "hubr.yaml"
 
-	vr, err := newVersioner(*vfile)
-	if err != nil {
-		return fmt.Errorf("open local repository: %s", err)
-	}
+// manifest is a yaml list of tools to install into a directory. The ident is
+// [org/]repo, the version is a tag or constraint defaulting to the latest
+// release and the asset is a glob, optional with auto. The mode is install
+// for executables, the default, or get for assets as they are downloaded.
+type manifest struct {
+	Tools []manifestTool `yaml:"tools"`
+}
 
-	ok, err := vr.isRelease()
+type manifestTool struct {
+	Ident   string `yaml:"ident"`
+	Version string `yaml:"version"`
+	Asset   string `yaml:"asset"`
+	Dest    string `yaml:"dest"`
+	Mode    string `yaml:"mode"`
+	Auto    bool   `yaml:"auto"`
+	Extract bool   `yaml:"extract"`
+	Strip   int    `yaml:"strip"`
+}
+
+// loadManifest reads the manifest at p.
+func loadManifest(p string) (manifest, error) {
+	var m manifest
+	b, err := ioutil.ReadFile(p)
 	if err != nil {
-		return fmt.Errorf("check head: %s", err)
+		return m, err
 	}
-
-	if !ok {
-		return errors.New("not a release")
+	if err := yaml.UnmarshalStrict(b, &m); err != nil {
+		return m, fmt.Errorf("%s: %s", p, err)
 	}
-
-	return nil
+	return m, nil
 }
 
-// Subcmd push creates a GitHub release for a release commit. Pushing is
-// idempotent. If the current commit is not a release commit, nothing happens.
-// If releases or release assets already exist, creation will nop.
-func push(args []string) error {
-	f := flag.NewFlagSet("push", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	vfile := f.String("v", "VERSION", "path to the version file in the repository")
-	draft := f.Bool("d", false, "leave as draft; do not publish release")
-	keepd := f.Bool("f", false, "use the full file path for uploads (default basename only)")
-	wkrs := f.Int("w", workers, "number of upload workers")
-	f.Parse(args)
-
-	if f.NArg() == 0 {
-		f.Usage()
-		os.Exit(2)
-	}
+// lockName returns the path of the lockfile of the manifest at p, which has
+// the extension .lock in place of that of the manifest.
+func lockName(p string) string {
+	return strings.TrimSuffix(p, filepath.Ext(p)) + ".lock"
+}
 
-	id, ok := parseID(f.Arg(0))
-	if !ok || id.tag != defaultTag {
-		log.Printf("failed to parse %s, does not match "+helpOrgPart+"<repo>", f.Arg(0))
-		f.Usage()
-		os.Exit(2)
-	}
-	uploads := f.Args()[1:]
+// lockedTool is a tool of a manifest resolved to a tag and the assets of its
+// release matching the asset glob, with their checksums.
+type lockedTool struct {
+	Source  string        `json:"source"`
+	Mode    string        `json:"mode,omitempty"`
+	Auto    bool          `json:"auto,omitempty"`
+	Extract bool          `json:"extract,omitempty"`
+	Strip   int           `json:"strip,omitempty"`
+	Tag     string        `json:"tag"`
+	Assets  []lockedAsset `json:"assets"`
+}
 
-	vr, err := newVersioner(*vfile)
-	if err != nil {
-		return fmt.Errorf("open local repository: %s", err)
-	}
+type lockedAsset struct {
+	Name   string `json:"name"`
+	ID     int64  `json:"id"`
+	SHA256 string `json:"sha256"`
+}
 
-	ok, err = vr.isRelease()
-	if err != nil {
-		return fmt.Errorf("check release commit: %s", err)
+// lockedTool returns the unresolved lock of the tool t.
+func (t manifestTool) lockedTool() (lockedTool, error) {
+	s := t.Ident
+	if t.Version != "" {
+		s += "@" + t.Version
 	}
-	if !ok {
-		log.Print("push: nop, head is not a release commit")
-		return nil
+	switch {
+	case t.Asset != "":
+		s += ":" + t.Asset
+	case t.Auto:
+		s += ":*"
+	default:
+		return lockedTool{}, fmt.Errorf("%s: no asset", t.Ident)
 	}
-
-	v, err := vr.head()
-	if err != nil {
-		return fmt.Errorf("get version of head: %s", err)
+	if t.Dest != "" {
+		s += ":" + t.Dest
 	}
 
-	h, err := vr.Head()
-	if err != nil {
-		return fmt.Errorf("get head: %s", err)
+	id, ok := parseID(s)
+	if !ok {
+		return lockedTool{}, fmt.Errorf("%s: failed to parse %s", t.Ident, s)
 	}
-
-	chs, err := vr.logDiff()
-	if err != nil {
-		return fmt.Errorf("get changes: %s", err)
+	switch t.Mode {
+	case "", "install":
+		t.Mode = ""
+	case "get":
+	default:
+		return lockedTool{}, fmt.Errorf("%s: unknown mode %s", t.Ident, t.Mode)
 	}
-
-	id.tag = v.String()
-	return spec{
-		id:      id,
-		draft:   *draft,
-		keepd:   *keepd,
-		sha:     h.Hash().String(),
-		name:    id.tag,
-		body:    strings.Join(chs, "\n"),
-		uploads: uploads,
-		wkrs:    *wkrs,
-	}.release()
+	return lockedTool{Source: id.String(), Mode: t.Mode, Auto: t.Auto, Extract: t.Extract, Strip: t.Strip}, nil
 }
 
-// Subcmd release creates a GitHub release for a tag.
-// If releases or release assets already exist, creation will nop.
-func release(args []string) error {
-	f := flag.NewFlagSet("release", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	name := f.String("name", "", "release name (defaults to tag)")
-	body := f.String("body", "", "release body string, or @file, or - to read from stdin")
-	sha := f.String("sha", "", "sha of release commit (defaults to detect from tag or head)")
-	draft := f.Bool("d", false, "leave as draft; do not publish release")
-	keepd := f.Bool("f", false, "use the full file path for uploads (default basename only)")
-	pre := f.Bool("pre", false, "create prerelease")
-	wkrs := f.Int("w", workers, "number of upload workers")
-	f.Parse(args)
-
-	if f.NArg() == 0 {
-		log.Print("release one or more arguments")
-		f.Usage()
-		os.Exit(2)
-	}
-
-	id, ok := parseID(f.Arg(0))
-	if !ok || id.tag == defaultTag || id.tag == "stable" || id.tag == "edge" {
-		log.Printf("failed to parse %s, does not match "+helpOrgPart+"<repo>@<tag>", f.Arg(0))
-		f.Usage()
-		os.Exit(2)
+// installation returns the installation of the locked tool from its tag.
+func (lt lockedTool) installation() installation {
+	in := installation{Source: lt.Source, Mode: lt.Mode, Auto: lt.Auto, Extract: lt.Extract, Strip: lt.Strip, Tag: lt.Tag}
+	for _, a := range lt.Assets {
+		in.Assets = append(in.Assets, installedAsset{Name: a.Name, ID: a.ID, SHA256: a.SHA256})
 	}
-	uploads := f.Args()[1:]
+	return in
+}
 
-	switch {
-	case *body == "-":
-		b, err := ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			return err
-		}
-		*body = string(b)
-	case len(*body) == 0:
-	case (*body)[0] == '@':
-		b, err := ioutil.ReadFile((*body)[1:])
-		if err != nil {
-			return err
-		}
-		*body = string(b)
-	}
+// same reports whether the locked tool has the same source and options as u.
+func (lt lockedTool) same(u lockedTool) bool {
+	return lt.Source == u.Source && lt.Mode == u.Mode && lt.Auto == u.Auto &&
+		lt.Extract == u.Extract && lt.Strip == u.Strip
+}
 
-	if *name == "" {
-		*name = id.tag
+// synced reports whether the installation in is the locked tool, with the
+// same tag and checksums, and all of its files are present in dir.
+func (lt lockedTool) synced(dir string, in installation) bool {
+	if !lt.same(lockedTool{Source: in.Source, Mode: in.Mode, Auto: in.Auto, Extract: in.Extract, Strip: in.Strip}) ||
+		in.Tag != lt.Tag || len(in.Assets) == 0 {
+		return false
 	}
-
-	if *sha == "" {
-		vr, err := newVersioner("")
-		if err != nil {
-			return fmt.Errorf("open local repository: %s", err)
-		}
-		ref, err := vr.Tag(id.tag)
-		switch err {
-		case nil:
-			obj, err := vr.TagObject(ref.Hash())
-			switch err {
-			case nil:
-				*sha = obj.Target.String()
-			case plumbing.ErrObjectNotFound:
-				*sha = ref.Hash().String()
-			default:
-				return err
-			}
-		case plumbing.ErrObjectNotFound, git.ErrTagNotFound:
-			h, err := vr.Head()
-			if err != nil {
-				return fmt.Errorf("get local head: %s", err)
-			}
-			*sha = h.Hash().String()
-		default:
-			return fmt.Errorf("local repository: %s", err)
+	sums := map[string]string{}
+	for _, a := range lt.Assets {
+		sums[a.Name] = a.SHA256
+	}
+	for _, a := range in.Assets {
+		if sums[a.Name] != a.SHA256 {
+			return false
 		}
 	}
-
-	return spec{
-		id:      id,
-		draft:   *draft,
-		pre:     *pre,
-		keepd:   *keepd,
-		sha:     *sha,
-		name:    *name,
-		body:    *body,
-		uploads: uploads,
-		wkrs:    *wkrs,
-	}.release()
+	for _, p := range in.paths() {
+		if _, err := os.Lstat(filepath.Join(dir, p)); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
-// Subcmd resolve resolves release tags.
-func resolve(args []string) error {
-	f := flag.NewFlagSet("resolve", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	w := f.Bool("w", false, "print web urls")
-	f.Parse(args)
-
-	args, err := readArgs(f.Args())
+// loadLock reads the locked tools of the lockfile at p.
+func loadLock(p string) ([]lockedTool, error) {
+	b, err := ioutil.ReadFile(p)
 	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
+		return nil, err
+	}
+	lts := []lockedTool{}
+	if err := json.Unmarshal(b, &lts); err != nil {
+		return nil, fmt.Errorf("%s: %s", p, err)
 	}
+	return lts, nil
+}
 
-	if len(args) == 0 {
-		f.Usage()
-		os.Exit(2)
+// saveLock replaces the lockfile at p.
+func saveLock(p string, lts []lockedTool) error {
+	b, err := json.MarshalIndent(lts, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	c, err := newClient()
+	f, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".hubr-")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+		return err
 	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	for _, arg := range args {
-		id, ok := parseID(arg)
-		if !ok {
-			return fmt.Errorf("failed to parse %s, does not match "+helpOrgPart+"<repo>[@<tag>]", f.Arg(0))
-		}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return commitFile(f, p, 0644)
+}
 
-		r, err := c.GetRelease(id)
+// checkLock returns an error if the locked tools lts are not those of the
+// manifest at p, in order. A missing manifest is not checked.
+func checkLock(p string, lts []lockedTool) error {
+	m, err := loadManifest(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(m.Tools) != len(lts) {
+		return fmt.Errorf("%s is out of date, run lock", lockName(p))
+	}
+	for i, t := range m.Tools {
+		lt, err := t.lockedTool()
 		if err != nil {
-			return fmt.Errorf("%s: %s", arg, err)
+			return err
 		}
-		id.tag = r.GetTagName()
-		switch {
-		case *w:
-			fmt.Println(r.GetHTMLURL())
-		default:
-			fmt.Println(id)
+		if !lt.same(lts[i]) {
+			return fmt.Errorf("%s is out of date, run lock", lockName(p))
 		}
 	}
 	return nil
 }
 
-// Subcmd say is a mystery, who knows what it truly does...
-func say(args []string) error {
-	c, err := newClient()
+// lockAssets resolves the tag of the locked tool lt and sets its assets. The
+// checksums are read from the checksum manifest of the release, or the asset
+// is downloaded and hashed if it is not listed. Checksums by asset id are
+// remembered in known. The checksum manifest and signatures are not locked.
+func lockAssets(c *client, lt *lockedTool, known map[int64]string) error {
+	id, _ := parseID(lt.Source)
+	as, err := c.GlobAssets(id)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+		return fmt.Errorf("%s: %s", lt.Source, err)
 	}
-	octolog(c, strings.Join(args, " "))
-	return nil
-}
-
-// Subcmd tags lists tags for a repo. By default only full release tags are listed.
-// With the -a flag, prereleases, draft releases, annotated and lightweight tags are
-// also printed.
-// With the -l flag, tags a printed one per line with additional information.
-func tags(args []string) error {
-	f := flag.NewFlagSet("tags", flag.ExitOnError)
-	f.Usage = usageFor(f)
-	list := f.Bool("l", false, "one per line, with description")
-	all := f.Bool("a", false, "list all including draft, pre-release and unreleased tags")
-	la := f.Bool("la", false, "shorthand for -l -a")
-	f.Parse(args)
 
-	args, err := readArgs(f.Args())
-	if err != nil {
-		log.Print(err)
-		f.Usage()
-		os.Exit(2)
-	}
+	var ss sums
+	lt.Assets = []lockedAsset{}
+	for _, a := range as {
+		lt.Tag = a.id.tag
+		if n := a.GetName(); n == sumsName || strings.HasSuffix(n, sigExt) {
+			continue
+		}
+		if a.sums != nil && ss == nil {
+			if ss, err = c.GetSums(a.id, a.sums); err != nil {
+				return fmt.Errorf("%s: %s", a.id, err)
+			}
+		}
 
-	if len(args) == 0 {
-		log.Print("tags requires at least one argument")
-		f.Usage()
-		os.Exit(2)
+		sum := ss[a.GetName()]
+		if sum == "" {
+			sum = known[a.GetID()]
+		}
+		if sum == "" {
+			log.Printf("hash %s", a.id)
+			rc, err := c.OpenAsset(a.id, &a.ReleaseAsset)
+			if err != nil {
+				return fmt.Errorf("%s: %s", a.id, err)
+			}
+			h := sha256.New()
+			t := prog.start(a.GetName(), int64(a.GetSize()), 0)
+			_, err = io.Copy(io.MultiWriter(h, t), rc)
+			t.done()
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %s", a.id, err)
+			}
+			sum = hex.EncodeToString(h.Sum(nil))
+		}
+		known[a.GetID()] = sum
+		lt.Assets = append(lt.Assets, lockedAsset{a.GetName(), a.GetID(), sum})
 	}
-
-	if *la {
-		*list, *all = true, true
+	if len(lt.Assets) == 0 {
+		return errNotFound{id}
 	}
+	return nil
+}
 
-	c, err := newClient()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: proceeding without token: %s\n", err)
-		c = &client{Client: github.NewClient(nil)}
+// installSources downloads the assets matching the source of each
+// installation and installs them into dir. The tag and assets of each
+// installation are set from what was installed. An installation with a tag
+// is installed from that tag, and if it has assets the checksum of each
+// download must match that of the asset of the same name.
+func installSources(c *client, wkr int, ks []ed25519.PublicKey, dir string, is []installation) error {
+	// setup a temp directory for install operations
+	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("hubr-%d", time.Now().Unix()))
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return fmt.Errorf("failed to create dir in %s: %s", os.TempDir(), err)
 	}
+	defer os.RemoveAll(tmp)
 
-	w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
-	for _, arg := range args {
-		id, ok := parseID(arg)
-		if !ok {
-			return fmt.Errorf("failed to parse %s, does not match "+helpOrgPart+"<repo>", f.Arg(0))
+	ass := make([][]asset, len(is))
+	d := newDowner(c, wkr, ks)
+	for i, in := range is {
+		id, _ := parseID(in.Source)
+		if in.Tag != "" {
+			id.tag = in.Tag
 		}
 
-		// get the releases, map them by tag, then get all the tags
-		rs, err := c.ListReleases(id)
+		as, err := c.GlobAssets(id)
 		if err != nil {
+			d.wait()
 			return err
 		}
-		m := make(map[string]*github.RepositoryRelease, len(rs))
-		for _, r := range rs {
-			m[r.GetTagName()] = r
+		if in.Auto {
+			a, err := selectPlatform(id, as, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				d.wait()
+				return err
+			}
+			// a binary named for its platform is installed under the repo name
+			a.id.dst = id.repo
+			if runtime.GOOS == "windows" {
+				a.id.dst += ".exe"
+			}
+			as = []asset{a}
 		}
-		ts, err := c.ListTags(id)
-		if err != nil {
-			return err
+
+		ass[i] = as
+		d.queue(tmp, as)
+	}
+
+	errs := d.wait()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
 		}
+		return errors.New("download failed")
+	}
 
-		if len(args) > 1 {
-			// headings for multiple args
-			io.WriteString(w, id.String()+":\n")
+	for i, in := range is {
+		want := map[string]string{}
+		for _, a := range in.Assets {
+			want[a.Name] = a.SHA256
 		}
 
-		i := 0
-		for _, t := range ts {
-			r, ok := m[t]
+		is[i].Assets = []installedAsset{}
+		is[i].Installed = time.Now().UTC()
+		for _, a := range ass[i] {
+			src := filepath.Join(tmp, a.id.dst)
+			dst := filepath.Join(dir, a.id.dst)
+
+			sum, err := fileSum(src)
+			if err != nil {
+				return err
+			}
+			if len(want) > 0 && sum != want[a.GetName()] {
+				return fmt.Errorf("%s: checksum %s does not match the locked checksum", a.id, sum)
+			}
+
+			var ps []string
+			t := detectContentType(src)
+			if t != a.GetContentType() {
+				log.Printf("warning: content type mismatch: detected %s, github reported %s", t, a.GetContentType())
+			}
 			switch {
-			case !*all && (!ok || r.GetDraft() || r.GetPrerelease()):
-				continue
-			case *list && ok:
-				io.WriteString(w, r.GetTagName()+"\trelease\t"+r.GetCreatedAt().Format("2006-01-02 15:04 MST"))
-				if r.GetPrerelease() {
-					io.WriteString(w, "\tpre-release")
-				}
-				if r.GetDraft() {
-					io.WriteString(w, "\tdraft")
-				}
-				io.WriteString(w, "\n")
-			case *list && *all:
-				io.WriteString(w, t+"\ttag\n")
+			case in.Mode == "get":
+				ps, err = installGet(src, dst, dir, t, in.extraction())
+			case t == "application/octet-stream":
+				ps, err = installBin(src, dst)
+			case t == "application/zip":
+				ps, err = installZip(src, dir, in.extraction())
+			case t == "application/x-gzip" || t == "application/x-xz" || t == "application/x-bzip2":
+				ps, err = installArchive(src, dst, dir, t, in.extraction(), 0755)
 			default:
-				n := "\t"
-				if i%5 == 4 {
-					n = "\n"
+				return fmt.Errorf("unsupported content type: %s", a.GetContentType())
+			}
+			if err != nil {
+				return err
+			}
+
+			// the paths made by extracting an archive include its new directories
+			files := []string{}
+			for _, p := range ps {
+				rel, err := filepath.Rel(dir, p)
+				if err != nil {
+					return err
 				}
-				io.WriteString(w, t+n)
-				i++
+				if fi, err := os.Lstat(p); err == nil && fi.IsDir() {
+					is[i].Dirs = mergeDirs(is[i].Dirs, []string{rel})
+					continue
+				}
+				files = append(files, rel)
 			}
-		}
-		if i%5 != 0 {
-			io.WriteString(w, "\n")
-		}
-		if len(args) > 1 {
-			io.WriteString(w, "\n")
+			is[i].Tag = a.id.tag
+			is[i].Assets = append(is[i].Assets, installedAsset{a.GetName(), a.GetID(), sum, files})
 		}
 	}
-	return w.Flush()
+	return nil
 }
 
-// Subcmd what lists the files that have changed or checks if named files have
-// changed since the previous release commit.
-func what(args []string) error {
-	f := flag.NewFlagSet("what", flag.ExitOnError)
-	vfile := f.String("v", "VERSION", "path to the version file in the repository")
-	all := f.Bool("all", false, "return success if all named files changed (default any)")
-	f.Usage = usageFor(f)
-	f.Parse(args)
+// installGet copies src to dst as it was downloaded, or with -extract
+// unpacks an archive into dir like get.
+func installGet(src, dst, dir, t string, x extraction) ([]string, error) {
+	switch {
+	case x.all && t == "application/zip":
+		return installZip(src, dir, x)
+	case x.all && (t == "application/x-gzip" || t == "application/x-xz" || t == "application/x-bzip2"):
+		return installArchive(src, dst, dir, t, x, 0644)
+	}
 
-	vr, err := newVersioner(*vfile)
+	f, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("open local repository: %s", err)
+		return nil, err
+	}
+	defer f.Close()
+	if err := installFile(f, dst, 0644); err != nil {
+		return nil, err
 	}
+	return []string{dst}, nil
+}
 
-	fs, err := vr.files()
+// installBin copies src to dst and makes it executable.
+// it may emit some warnings which may or may not be helpful depending on the context.
+func installBin(src, dst string) ([]string, error) {
+	srcf, err := os.Open(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer srcf.Close()
 
-	if f.NArg() == 0 {
-		ss := []string{}
-		for s := range fs {
-			ss = append(ss, s)
+	if err := installFile(srcf, dst, 0755); err != nil {
+		return nil, err
+	}
+	return []string{dst}, nil
+}
+
+// installZip unzips the entries of the zip file src selected by x into dir,
+// and returns the installed paths and the directories made for them.
+// it may emit some warnings which may or may not be helpful depending on the context.
+func installZip(src, dir string, x extraction) ([]string, error) {
+	rc, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	ps := []string{}
+	for _, f := range rc.File {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
 		}
-		sort.Strings(ss)
-		for _, s := range ss {
-			fmt.Println(s)
+		// the target of a symlink is stored as its contents
+		var link string
+		if f.Mode()&os.ModeSymlink != 0 {
+			b, err := ioutil.ReadAll(io.LimitReader(r, 4096))
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			link = string(b)
 		}
-		return nil
+		p, err := x.install(dir, f.Name, f.Mode(), link, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p...)
+	}
+	return ps, nil
+}
+
+// installArchive decompresses the gzip, xz or bzip2 file src of content type t.
+// A compressed tarball has the entries selected by x extracted into dir,
+// anything else is treated as a single compressed file and installed to dst
+// with the compression extension removed and the given mode. If dst has no
+// extension the file replaces src.
+func installArchive(src, dst, dir, t string, x extraction, mode os.FileMode) ([]string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	nc := []string{}
-	for _, arg := range f.Args() {
-		p := path.Clean(arg)
-		if *all {
-			if !fs[p] {
-				nc = append(nc, p)
-			}
-			continue
+	var r io.Reader
+	switch t {
+	case "application/x-gzip":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
 		}
-		if fs[p] {
-			return nil
+		defer zr.Close()
+		r = zr
+	case "application/x-xz":
+		r, err = xz.NewReader(f)
+		if err != nil {
+			return nil, err
 		}
+	case "application/x-bzip2":
+		r = bzip2.NewReader(f)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", t)
 	}
-	if !*all {
-		return errors.New("no changes detected")
-	}
-	if len(nc) > 0 {
-		return errors.New("no changes detected: " + strings.Join(nc, ", "))
+
+	br := bufio.NewReader(r)
+	if isTar(br) {
+		return installTar(br, dir, x)
 	}
-	return nil
-}
 
-// Subcmd who prints the owner of the GitHub personal access token used by hubr.
-func who(args []string) error {
-	c, err := newClient()
-	if err != nil {
-		return err
+	for _, ext := range []string{".gz", ".xz", ".bz2"} {
+		if strings.HasSuffix(dst, ext) {
+			dst = strings.TrimSuffix(dst, ext)
+			break
+		}
 	}
-	u, _, err := c.Users.Get(ctxbg, "")
-	if err != nil {
-		return err
+	if err := installFile(br, dst, mode); err != nil {
+		return nil, err
 	}
-	fmt.Println(u.GetLogin())
-	return nil
+	return []string{dst}, nil
 }
 
-// detectContentType determines the mime type of the file at path.
-func detectContentType(path string) string {
-	f, err := os.Open(path)
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-
-	b := make([]byte, 512)
-	_, err = f.Read(b)
+// isTar reports whether r begins with a ustar or gnu tar header,
+// the peeked bytes are not consumed.
+func isTar(r *bufio.Reader) bool {
+	b, err := r.Peek(262)
 	if err != nil {
-		return ""
+		return false
 	}
-
-	return http.DetectContentType(b)
+	return string(b[257:262]) == "ustar"
 }
 
-// credHelper attempts to invoke a git credential helper by parsing git config
-// first in a local repository if present and then in the home directory.
-// if anything goes wrong it returns an empty string.
-func credHelper() string {
-	find := func(p string) string {
-		f, err := os.Open(p)
-		if err != nil {
-			return ""
+// installTar extracts the entries of the tar stream r selected by x into dir,
+// and returns the installed paths and the directories made for them.
+// it may emit some warnings which may or may not be helpful depending on the context.
+func installTar(r io.Reader, dir string, x extraction) ([]string, error) {
+	ps := []string{}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return ps, nil
 		}
-		defer f.Close()
-		var c config.Config
-		if err := config.NewDecoder(f).Decode(&c); err != nil {
-			return ""
+		if err != nil {
+			return nil, err
 		}
-		for _, s := range c.Sections {
-			if s.Name != "credential" {
-				continue
-			}
-			for _, o := range s.Options {
-				if o.Key == "helper" {
-					return o.Value
-				}
+		// a hard link has the mode of a regular file but no contents
+		if h.Typeflag == tar.TypeLink {
+			if x.all {
+				log.Printf("warning: skipped hard link %s", h.Name)
 			}
+			continue
 		}
-		return ""
-	}
 
-	var h string
-	d, err := locateGitDir(".")
-	if err == nil {
-		h = find(filepath.Join(d, ".git", "config"))
-	}
-	if h == "" {
-		h = find(filepath.Join(os.Getenv("HOME"), ".gitconfig"))
-	}
-	if h == "" {
-		return ""
+		p, err := x.install(dir, h.Name, h.FileInfo().Mode(), h.Linkname, tr)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p...)
 	}
+}
 
-	// see https://git-scm.com/docs/gitcredentials#gitcredentials-helper
-	if h[0] != filepath.Separator {
-		h = "git credential-" + h
-	}
-	h = h + " get"
+// extraction selects the archive entries which are installed and where.
+type extraction struct {
+	all   bool // every entry rather than only executable files
+	strip int  // the number of leading path components removed from names
+}
 
-	// using sh seems to be the easiest way to deal with the helper string
-	// without having to split the args
-	r, w := io.Pipe()
-	cmd := exec.Command("/bin/sh", "-c", h)
-	cmd.Stdin = strings.NewReader("protocol=https\nhost=github.com\n")
-	cmd.Stdout = w
-	if err := cmd.Start(); err != nil {
-		return ""
+// install installs the archive entry name of the given mode into dir, reading
+// a regular file from r or making a symlink to link. It returns the
+// directories it made followed by the installed path, or nothing if the
+// entry is not selected.
+func (x extraction) install(dir, name string, mode os.FileMode, link string, r io.Reader) ([]string, error) {
+	if !x.all && (!mode.IsRegular() || mode&0111 == 0) {
+		return nil, nil
 	}
 
-	done := make(chan error)
-	var t string
-	s := bufio.NewScanner(r)
+	dst, err := entryPath(dir, name, x.strip)
+	if err != nil || dst == "" {
+		return nil, err
+	}
 
-	go func() { done <- cmd.Wait() }()
-	go func() {
-		for s.Scan() {
-			p := strings.Split(s.Text(), "=")
-			if len(p) != 2 {
-				continue
-			}
-			if p[0] == "password" {
-				t = p[1]
-				done <- nil
-			}
+	switch {
+	case mode.IsDir():
+		return mkdirs(dst)
+	case mode&os.ModeSymlink != 0:
+		ds, err := mkdirs(filepath.Dir(dst))
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	select {
-	case <-time.After(5 * time.Second):
-		cmd.Process.Kill()
-		// i really don't like printing here, but i don't want to add err return
-		fmt.Fprintln(os.Stderr, "cred helper timeout: 5sec")
-		return ""
-	case err := <-done:
+		return append(ds, dst), installLink(dir, dst, link)
+	case mode.IsRegular():
+		ds, err := mkdirs(filepath.Dir(dst))
 		if err != nil {
-			// as above, it's not right printing this deep
-			fmt.Fprintf(os.Stderr, "error from cred helper: %v\n", err)
-			return ""
+			return nil, err
 		}
+		return append(ds, dst), installFile(r, dst, mode)
 	}
 
-	return t
+	log.Printf("warning: skipped %s, unsupported entry type %s", name, mode.Type())
+	return nil, nil
 }
 
-// detectExecutable detects if the file at path is a pe, mach-o or elf executable.
-func detectExecutable(path string) string {
-	pf, err := pe.Open(path)
-	if err == nil {
-		pf.Close()
-		return "windows"
+// mkdirs makes the directory p and any missing parents, and returns those it
+// made, parents first.
+func mkdirs(p string) ([]string, error) {
+	ds := []string{}
+	for d := p; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		ds = append([]string{d}, ds...)
 	}
+	return ds, os.MkdirAll(p, 0755)
+}
 
-	mf, err := macho.Open(path)
-	if err == nil && mf.FileHeader.Type == macho.TypeExec {
-		mf.Close()
-		return "darwin"
+// entryPath returns the path in dir of the archive entry name with strip
+// leading components removed, or "" if nothing remains of the name. A name
+// which is absolute or escapes dir is an error, as is a path which passes
+// through a symlink that an earlier entry could have made.
+func entryPath(dir, name string, strip int) (string, error) {
+	n := strings.Replace(name, `\`, "/", -1)
+	if path.IsAbs(n) || filepath.VolumeName(n) != "" {
+		return "", fmt.Errorf("%s: illegal absolute path in archive", name)
+	}
+	n = path.Clean(n)
+	if n == ".." || strings.HasPrefix(n, "../") {
+		return "", fmt.Errorf("%s: illegal path outside of %s in archive", name, dir)
 	}
 
-	ef, err := elf.Open(path)
-	if err == nil && ef.FileHeader.Type == elf.ET_EXEC {
-		ef.Close()
-		return "linux"
+	ps := strings.Split(n, "/")
+	if n == "." || len(ps) <= strip {
+		return "", nil
 	}
+	ps = ps[strip:]
 
-	return ""
+	p := dir
+	for _, c := range ps[:len(ps)-1] {
+		p = filepath.Join(p, c)
+		fi, err := os.Lstat(p)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s: illegal path through symlink %s in archive", name, p)
+		}
+	}
+	return filepath.Join(dir, filepath.Join(ps...)), nil
 }
 
-// installBin copies src to dst and makes it executable.
-// it may emit some warnings which may or may not be helpful depending on the context.
-func installBin(src, dst string) error {
-	dstf, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
+// installLink makes dst a symlink to link. The link must be relative and
+// must not point outside of dir, nor pass through a symlink, which an earlier
+// entry could have made to move the link outside of dir.
+func installLink(dir, dst, link string) error {
+	if link == "" || filepath.IsAbs(link) || path.IsAbs(link) {
+		return fmt.Errorf("%s: illegal symlink to %q in archive", dst, link)
+	}
+	rel, err := filepath.Rel(dir, filepath.Join(filepath.Dir(dst), filepath.FromSlash(link)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: illegal symlink to %q outside of %s in archive", dst, link, dir)
+	}
+	cs := strings.Split(filepath.ToSlash(link), "/")
+	p := filepath.Dir(dst)
+	for _, c := range cs[:len(cs)-1] {
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			p = filepath.Dir(p)
+			continue
+		}
+		p = filepath.Join(p, c)
+		fi, err := os.Lstat(p)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: illegal symlink to %q through symlink %s in archive", dst, link, p)
+		}
+	}
+
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	srcf, err := os.Open(src)
+	if err := os.Symlink(link, dst); err != nil {
+		return err
+	}
+	log.Printf("  %s -> %s", dst, link)
+	return nil
+}
+
+// installFile writes r to dst with the given mode and warns if an
+// executable result is not an executable for this os. The file is written beside dst
+// and renamed over it so an existing install, even a running executable,
+// is replaced in one step and an interrupted write leaves no partial file.
+func installFile(r io.Reader, dst string, mode os.FileMode) error {
+	o, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".hubr-")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(o.Name())
+	defer o.Close()
 
-	if _, err = io.Copy(dstf, srcf); err != nil {
+	if _, err := io.Copy(o, r); err != nil {
+		return err
+	}
+	if err := commitFile(o, dst, mode); err != nil {
 		return err
 	}
-	srcf.Close()
-	dstf.Close()
 
 	x := detectExecutable(dst)
 	switch {
+	case mode&0111 == 0:
 	case x == "":
 		log.Printf("warning: %s is not a known executable binary format", dst)
 	case x != runtime.GOOS:
@@ -2271,47 +7446,60 @@ func installBin(src, dst string) error {
 	return nil
 }
 
-// installZip unzips executable files in the zip file src into dir.
-// it may emit some warnings which may or may not be helpful depending on the context.
-func installZip(src, dir string) error {
-	rc, err := zip.OpenReader(src)
+// writeVersion sets the version field of the version file at p of kind k to
+// v, preserving the rest of the file.
+func writeVersion(p string, k versionKind, v version) error {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	c, err := k.replace(string(b), v)
+	if err != nil {
+		return fmt.Errorf("%s: %s", p, err)
+	}
+	fi, err := os.Stat(p)
 	if err != nil {
 		return err
 	}
-	for _, f := range rc.File {
-		if f.FileInfo().Mode()&0111 == 0 {
-			continue
-		}
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
-
-		dst := filepath.Join(dir, f.Name)
-
-		o, err := os.Create(dst)
-		if err != nil {
-			return err
-		}
-		defer o.Close()
 
-		if _, err := io.Copy(o, rc); err != nil {
-			return err
-		}
-		if err := os.Chmod(dst, f.FileInfo().Mode()); err != nil {
-			return err
-		}
+	f, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(c); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := commitFile(f, p, fi.Mode()); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
 
-		x := detectExecutable(dst)
-		switch {
-		case x == "":
-			log.Printf("warning: %s is not a known executable binary format", dst)
-		case x != runtime.GOOS:
-			log.Printf("warning: %s is a %s executable, os is %s", dst, x, runtime.GOOS)
-		}
+// commitFile moves the fully written temporary file f to dst. The file is
+// synced to disk, closed and given mode before it is renamed over dst, and the
+// directory is synced so the rename survives a crash. The caller removes f on
+// error, a temporary file must be in the same directory as dst.
+func commitFile(f *os.File, dst string, mode os.FileMode) error {
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %s", dst, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %s: %s", dst, err)
+	}
+	if err := os.Chmod(f.Name(), mode.Perm()); err != nil {
+		return fmt.Errorf("chmod %s: %s", dst, err)
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("rename %s: %s", dst, err)
+	}
 
-		log.Printf("  %s", dst)
+	// not every platform can sync a directory, the file itself is safe
+	if d, err := os.Open(filepath.Dir(dst)); err == nil {
+		d.Sync()
+		d.Close()
 	}
 	return nil
 }
@@ -2490,6 +7678,17 @@ var (
 		}
 		return "[<org>/]"
 	}()
+	// the tag of an ident may be a semver constraint
+	helpConstraint = `
+  The tag may be a semver constraint such as ^1.4, ~2.3.1 or ">=1.0 <2.0",
+  which resolves to the highest matching full release. Prereleases match only
+  if the constraint has a prerelease, such as ^2.0.0-0. Only a tag which is
+  a whole semver, such as v2.0.0-rc.1, has a prerelease, so v1.2.3-linux is
+  a prerelease but tool-1.2.3-linux is not. A version without an
+  operator or wildcard, such as v1 or 1.4, is a literal tag; use 1.4.x to
+  match its releases. The tag prefix of a component may precede the tag or
+  constraint, as in svc-a/v1.2.3 or svc-a/^1.2, which only matches releases
+  with that prefix.`
 	helpDefaultOrg = func() string {
 		if defaultOrg == "" {
 			return "\n  A default org may be set by env HUBR_DEFAULT_ORG"
@@ -2503,10 +7702,48 @@ var helpMain = `Usage: %s [opts] <cmd>
 
   Command %s deals with GitHub tags, releases and assets.
 
-  A GitHub personal access token is required. The following chain of token
+  A GitHub token is required. The following chain of token
   sources was specified at build time:
   	` + defaultChain + `
 
+  The chain may be replaced with -auth or env HUBR_AUTH_CHAIN. It is a comma
+  separated list of sources, the first which yields a token is used:
+  	env:<name>       the environment variable name
+  	file:<path>      the contents of the file at path
+  	exec:<command>   the standard output of command, run with sh
+  	keyring:<svc>    the password of service svc[/account] in the os keyring
+  	ssm:<param>      the aws ssm parameter param, decrypted
+  	app:<id>[/<installation>]:<source>
+  	                 an installation token of the GitHub App id, signed by
+  	                 the private key read from source, such as file:app.pem
+  The installation is the one on the default org, or the only one of the app.
+  App tokens are refreshed when they expire. If no source yields a token a
+  git credential helper is tried. A comma within a source, such as in an exec
+  command, is written \, and any other backslash is kept as it is.
+
+  In GitHub Actions, when env GITHUB_ACTIONS is true, the source
+  actions:GITHUB_TOKEN is appended to the chain, reading env GITHUB_TOKEN of
+  the workflow step, and on a GitHub Enterprise Server runner its url is used.
+
+  To use a GitHub Enterprise Server, set -url or env HUBR_GITHUB_URL to the
+  server url, for example https://ghe.example.com. The upload url is derived
+  from it unless -upload-url or env HUBR_GITHUB_UPLOAD_URL is set.
+
+  Requests failing with a network error, a server error or a rate limit are
+  retried with backoff, up to -retries attempts.
+
+  List calls read every page of results. The number of pages read may be
+  limited by env HUBR_PAGE_LIMIT.
+
+  The progress of uploads and downloads is shown on standard error, redrawn
+  on a terminal or as a line every ten seconds otherwise. Use -q to silence.
+
+  GitHub responses are kept in the cache directory, see cache, and revalidated
+  with conditional requests which do not count against the rate limit. With
+  -offline or env HUBR_OFFLINE=true no network requests are made, commands
+  such as resolve, tags, assets and get answer from the cache, and anything
+  missing from it is an error.
+
   For more help, -h any subcommand.
 `
 
@@ -2517,14 +7754,19 @@ var help = map[string]string{
   List release assets for one or more release tags. The parameter "-" will cause
   additional parameters to be read from standard input.
 
+  With -json, one json object is printed per asset. With -format, each asset is
+  printed using a go text/template, see https://godoc.org/text/template.
+  The fields are .Ident, .Tag, .State (draft, pre or full), .ID,
+  .Name, .Size, .ContentType, .Label and .URL.
+
 Parameter: ` + helpOrgPart + `<repo>[@<tag>][:<asset>]` + helpDefaultOrg + `
-  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.
+  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.` + helpConstraint + `
   The value of asset is a glob, see https://godoc.org/path/filepath#Match.
   The default pattern matches all assets.
 `,
 
 	// usage of the bump command
-	"bump": `Usage: %s %s [opts] <major|minor|patch>
+	"bump": `Usage: %s %s [opts] <major|minor|patch|prerelease|rc|release|auto>
 
   Create a new semantic version from a version file at head. If no version file
   is present the starting version is v0.0.0. Runs in local git repository. If
@@ -2532,6 +7774,21 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>][:<asset>]` + helpDefaultOrg + `
   GitHub release. The resulting version string may be emitted on stdout or
   written to a version file.
 
+  Versions follow semver 2.0, see https://semver.org. Build metadata is dropped.
+  For a prerelease such as 1.3.0-rc.2, major, minor and patch release the
+  prerelease when it precedes that version, so minor gives 1.3.0. The increment
+  prerelease increments the last number of a prerelease, or increments the
+  patch and appends -0. The increment rc increments an rc.N prerelease, changes
+  any other prerelease to rc.1, or increments the patch and appends -rc.1. The
+  increment release drops the prerelease. An increment which does not give a
+  later version, such as rc of 1.3.0-rc1, is an error.
+
+  The increment auto is chosen from the commits of the log, read as
+  Conventional Commits, see https://www.conventionalcommits.org. A breaking
+  change, marked by ! after the type or a BREAKING CHANGE footer, is major. A
+  feat type is minor, anything else is patch. The chosen increment is logged on
+  standard error. It is not allowed with -latest.
+
   A changelog is generated if the -n flag is not present. First, a mainline is
   calculated from head. For any merge commit, the mainline is considered to be
   any parent commit where the version does not change.
@@ -2540,9 +7797,66 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>][:<asset>]` + helpDefaultOrg + `
   the current value of the version file. Any branches encontered are traversed
   back to the mainline and their commit messages inserted.
 
+  If any commit of the log is a Conventional Commit, the log is grouped into
+  sections of breaking changes, features, fixes and other commits and the type
+  is removed from each entry.
+
   The log for the new version may be printed on standard output or written to
   the version file. New lines are prepended to the committed content of the
   version file.
+
+  The version file may instead be a structured file with a version field, of
+  a kind chosen by its name or the -kind flag: json for package.json, cargo
+  for the package table of Cargo.toml, pyproject for the project or
+  tool.poetry table of pyproject.toml, chart for a Helm Chart.yaml and go for
+  a Version constant or variable in a .go file. The version field of json is
+  the top-level "version" key. With -w only the version field is
+  updated, and the log is printed on standard output for the commit message.
+  The release body of push is then the changelog of the release commit.
+
+  With -tags there is no version file. The version is the highest version tag
+  reachable from head, a tag such as v1.2.3 or 1.2.3, and the log is of the
+  commits since any version tag. With -w an annotated tag of the new version
+  is created at head with the log as its message, push it with git push --tags.
+
+  With -c the version and log are of a component of the repository, see
+  components.
+
+  The log is rendered by a go text/template, see
+  https://golang.org/pkg/text/template. The -template flag names a built in
+  template, plain, markdown or keepachangelog, or a template file. The default
+  is the file ` + changelogFile + ` at the root of the repository if present,
+  otherwise plain. A template is given .Version, .Previous, .Date, .Commits,
+  the groups .Breaking, .Features, .Fixes and .Other and .Sections, a list of
+  the groups which are not empty with a .Title and .Commits. Each commit has
+  .Hash, .Author, .Email, .Date, .Type, .Scope, .Breaking, .Subject, .Body and
+  .Trailers, a map of trailer token to values.
+`,
+
+	// usage of the cache command
+	"cache": `Usage: %s %s [opts] ls|prune|clear
+
+  Manage the download cache. Verified downloads of get, cat, install, upgrade
+  and sync are kept in the cache, and an asset is copied from the cache rather
+  than downloaded when the same asset id, size and update time, or the same
+  checksum, was downloaded before. Contents are stored once per checksum and
+  are verified against it when used.
+
+  The cache directory is the -cache flag, env HUBR_CACHE or hubr in the user
+  cache directory. An empty directory disables the cache. After each download
+  the least recently used assets are evicted until the cache is no larger than
+  env HUBR_CACHE_MAX, 2G by default, or 0 for unlimited.
+
+  GitHub api responses are cached in the same directory and revalidated by
+  ETag. They count towards the same maximum size and are evicted with the
+  assets, least recently used first, once the command is done. With -offline,
+  releases, tags and assets are only read from the cache, so a cache filled
+  online can be used on a builder without network access.
+
+Parameter: ls|prune|clear
+  ls lists the cached assets and api responses, least recently used first.
+  prune evicts least recently used assets and api responses down to the
+  maximum size, or -max. clear empties the cache.
 `,
 
 	// usage of the cat command
@@ -2554,20 +7868,75 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>][:<asset>]` + helpDefaultOrg + `
   safe to use to write to stdout. The get command is guaranteed to run faster
   if more than one asset is got.
 
+  If the release has a ` + sumsName + ` checksum manifest, downloads are
+  verified against it and a mismatch is an error.
+
+  If the -keys flag or env HUBR_TRUSTED_KEYS names a file of trusted public
+  keys, every asset must have a <asset>.sig signature asset from one of the
+  keys. Assets are verified before they are written to the destination.
+
 Parameter: ` + helpOrgPart + `<repo>[@<tag>]:<asset>` + helpDefaultOrg + `
-  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.
+  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.` + helpConstraint + `
   The value of asset is a glob, see https://godoc.org/path/filepath#Match.
   The default pattern matches all assets.
 `,
 
+	// usage of the components command
+	"components": `Usage: %s %s [opts]
+
+  List the components of the local repository which changed since their last
+  release, as calculated by what. Components are independently versioned
+  parts of a repository, such as the services of a monorepo, described by the
+  file ` + componentsFile + ` at the root of the repository:
+
+    components:
+      svc-a:
+        version: svc-a/package.json
+        paths: [svc-a, lib]
+        tagPrefix: svc-a/
+
+  The version file defaults to VERSION in the directory named after the
+  component, the source paths to the directory of the version file and the
+  tag prefix to the name followed by a slash. The version file is of the kind
+  for its name unless "kind" is set, see bump. Release tags of a component
+  are the tag prefix followed by the version, such as svc-a/v1.2.3.
+
+  Commands bump, now, push and what select a component with -c. Only commits
+  and files in the source paths of a component are in its log and changes.
+  Its releases are named with the tag prefix, as in get org/repo@svc-a/^1.2.
+`,
+
 	// usage of the get command
 	"get": `Usage: %s %s [opts] ` + helpOrgPart + `<repo>[@<tag>]:<asset>[:<dest>] [...]
 
   Download one or more release assets to the working directory. The parameter "-"
   will cause additional parameters to be read from standard input.
 
+  A dropped connection is resumed with a ranged request. A download which
+  still fails leaves a hidden partial file in the directory, which the next
+  get of the same asset resumes from.
+
+  If the release has a ` + sumsName + ` checksum manifest, downloads are
+  verified against it and a mismatch is an error.
+
+  If the -keys flag or env HUBR_TRUSTED_KEYS names a file of trusted public
+  keys, every asset must have a <asset>.sig signature asset from one of the
+  keys. Assets are verified before they are written to the destination.
+
+  With -extract, zip archives and compressed tarballs are unpacked into the
+  directory and removed, and other compressed files are decompressed without
+  their .gz, .xz or .bz2 extension. Entries outside of the directory, absolute
+  symlinks and symlinks out of the directory or through another symlink are
+  an error. The -strip flag removes leading path components of entry names,
+  entries with no name left are skipped.
+
+  With -auto the asset is selected by matching asset names against the os
+  and arch, including common aliases such as x86_64, aarch64 and macos. The
+  asset glob is optional and narrows the candidates. It is an error if more
+  than one asset matches equally well.
+
 Parameter: ` + helpOrgPart + `<repo>[@<tag>]:<asset>[:<dest>]` + helpDefaultOrg + `
-  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.
+  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.` + helpConstraint + `
   The value of asset is a glob, see https://godoc.org/path/filepath#Match.
   The default pattern matches all assets.
   The default dest is the name of the asset, dest is not allowed when globbing.
@@ -2578,22 +7947,91 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>]:<asset>[:<dest>]` + helpDefaultOrg
 
   Install one or more standalone executables to a directory. The parameter "-"
   will cause additional parameters to be read from standard input.
+  With -auto a single binary asset is installed with the name of the repo.
+
+  Each install is recorded in ` + installedName + ` in the directory with its
+  source, resolved tag, assets, checksums and installed files. See installed,
+  upgrade and uninstall.
+
+  Supports application/octet-stream, application/zip and gzip, xz or bzip2
+  compressed tarballs or single binaries. Executable files are extracted from
+  archives into the directory preserving their modes, or every entry with
+  -extract. The -strip flag removes leading path components of entry names.
+  Entries outside of the directory, absolute symlinks and symlinks out of the
+  directory are an error.
+
+  If the release has a ` + sumsName + ` checksum manifest, downloads are
+  verified against it and a mismatch is an error.
 
-  Supports application/octet-stream and application/zip.
+  If the -keys flag or env HUBR_TRUSTED_KEYS names a file of trusted public
+  keys, every asset must have a <asset>.sig signature asset from one of the
+  keys. Assets are verified before they are written to the destination.
+
+  With -auto the asset is selected by matching asset names against the os
+  and arch, including common aliases such as x86_64, aarch64 and macos. The
+  asset glob is optional and narrows the candidates. It is an error if more
+  than one asset matches equally well.
 
 Parameter: ` + helpOrgPart + `<repo>[@<tag>]:<asset>[:<dest>]` + helpDefaultOrg + `
-  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.
+  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.` + helpConstraint + `
   The value of asset is a glob, see https://godoc.org/path/filepath#Match.
   The default pattern matches all assets.
   The default dest is the name of the asset, dest is not allowed when globbing.
 `,
 
+	// usage of the installed command
+	"installed": `Usage: %s %s [opts]
+
+  List the tools installed in a directory by install, with the tag, source
+  and files of each.
+`,
+
+	// usage of the keygen command
+	"keygen": `Usage: %s %s [opts]
+
+  Create an ed25519 key pair for signing release assets. The private key is
+  written to a file readable only by the owner, and the public key to the same
+  file name with a .pub extension. Existing files are never overwritten.
+
+  Sign uploads with push -sign or release -sign. Verify downloads with get
+  -keys, install -keys or cat -keys, where the keys file lists one or more
+  trusted public keys, one per line.
+`,
+
+	// usage of the lock command
+	"lock": `Usage: %s %s [opts]
+
+  Resolve the tools of a manifest into a lockfile with the exact tag, asset
+  ids and sha256 checksums of each. The manifest is yaml, ` + manifestName + ` by
+  default, and the lockfile has the same name with the extension .lock:
+
+    tools:
+      - ident: myob-oss/hubr     # [org/]repo
+        version: ^0.6            # tag or constraint, default latest
+        asset: "*-linux.zip"     # glob, optional with auto
+        dest: hubr               # destination name of a single asset
+        mode: install            # install executables, or get as downloaded
+        auto: false              # select the asset for the os and arch
+        extract: false           # extract every archive entry
+        strip: 0                 # remove leading path components of entries
+
+  Every asset matching the glob is locked, so that auto selection works from
+  the lockfile on any platform. Checksums are read from the release's
+  ` + sumsName + ` checksum manifest, or assets which are not listed are
+  downloaded and hashed.
+
+  Tools already in the lockfile with the same manifest entry are kept at their
+  locked tag unless -u is present. See sync.
+`,
+
 	// usage of the now command
 	"now": `Usage: %s %s [opts]
 
   Test if the local repository head is a release commit. Based on version file.
   A release commit is any non-merge commit where the version file changes.
-  See also bump, push.
+  With -tags, a release commit is any commit with a version tag higher than
+  that reachable from its parents. With -c, the release commits are those of a
+  component, see components. See also bump, push.
 `,
 
 	// usage of the push command
@@ -2603,20 +8041,48 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>]:<asset>[:<dest>]` + helpDefaultOrg
   current commit is not a release commit, nothing happens. Push is based on a
   version file. A release commit is any non-merge commit where the version file
   changes. The release version is the value of the version file in a release
-  commit.
+  commit. A version with a semver prerelease part is released as a prerelease,
+  which needs the version to be a whole semver such as 1.3.0-rc.1.
 
   If a tag does not exist for the release version, one is created. If the
   release does not exist it is created as a draft. The release body is created
   from additions to the changelog file in the release commit.
 
+  If the -template flag is present, or the file ` + changelogFile + ` is at the
+  root of the repository, the release body is instead rendered by the changelog
+  template from the log of the release, as calculated by bump. See bump for the
+  templates and the values given to them.
+
   Any asset files are uploaded. If the -f flag is present the full path of the
   file is used for the name. GitHub will replace path separators with dots.
-  Otherwise, the basename will be used. If a release asset already exists,
-  nothing happens.
+  Otherwise, the basename will be used. If a release asset already exists
+  with the same checksum, nothing happens, and if it differs it is an error.
+
+  If the -sums flag is present a ` + sumsName + ` checksum manifest of the
+  uploaded files is uploaded, merged with any existing manifest. If a release
+  asset already exists and is listed in the manifest, the checksums must match.
+
+  If the -sign flag or env HUBR_SIGNING_KEY names a private key created by
+  keygen, a detached signature asset <asset>.sig is uploaded for each asset,
+  and for the checksum manifest. The signature is an ed25519 signature of the
+  release tag, the asset name and the sha256 digest of the asset, so a signed
+  asset cannot be replayed as another asset or release. Without a key, the
+  signature of a changed checksum manifest is deleted.
 
   If the release is in draft state and the -d flag is present, the release
   remains in a draft state. Otherwise the release is published.
 
+  With -tags the version is the version tag at head, see bump, and the release
+  body is the tag message unless a changelog template is used.
+
+  With -c the component's version is released, tagged with its tag prefix.
+  See components.
+
+  In GitHub Actions the <repo> may be given as . or omitted without upload
+  files to push to the repository of the workflow, env GITHUB_REPOSITORY, as
+  in: push . dist/*.zip. The step outputs are set, see release, and released
+  is false if head is not a release commit.
+
 Parameter: ` + helpOrgPart + `<repo>` + helpDefaultOrg + `
 
 Parameter: <asset-file>
@@ -2633,14 +8099,34 @@ Parameter: <asset-file>
 
   Any asset files are uploaded. If the -f flag is present the full path of the
   file is used for the name. GitHub will replace path separators with dots.
-  Otherwise, the basename will be used. If a release asset already exists,
-  nothing happens.
+  Otherwise, the basename will be used. If a release asset already exists
+  with the same checksum, nothing happens, and if it differs it is an error.
+
+  If the -sums flag is present a ` + sumsName + ` checksum manifest of the
+  uploaded files is uploaded, merged with any existing manifest. If a release
+  asset already exists and is listed in the manifest, the checksums must match.
+
+  If the -sign flag or env HUBR_SIGNING_KEY names a private key created by
+  keygen, a detached signature asset <asset>.sig is uploaded for each asset,
+  and for the checksum manifest. The signature is an ed25519 signature of the
+  release tag, the asset name and the sha256 digest of the asset, so a signed
+  asset cannot be replayed as another asset or release. Without a key, the
+  signature of a changed checksum manifest is deleted.
 
   If the release is in draft state and the -d flag is present, the release
   remains in a draft state. Otherwise the release is published.
 
+  In GitHub Actions a tag which is not in the local repository is created at
+  env GITHUB_SHA rather than head when releasing the repository of the
+  workflow, env GITHUB_REPOSITORY. The <repo> may be given as @<tag> to
+  release the repository of the workflow. On a tag push it may be given as .
+  or omitted without asset files to release the pushed tag, as in:
+  release . dist/*.zip. The step outputs released, draft, tag, sha,
+  release_id, release_url, upload_url and asset_urls, the download url of each
+  asset one per line, are written to env GITHUB_OUTPUT.
+
 Parameter: ` + helpOrgPart + `<repo>@<tag>` + helpDefaultOrg + `.
-  Tag values ` + defaultTag + `, stable, edge are not allowed.
+  Tag values ` + defaultTag + `, stable, edge and constraints are not allowed.
 
 Parameter: <asset-file>
   A path to a local release asset to be uploaded.
@@ -2655,8 +8141,28 @@ Parameter: <asset-file>
   The output of resolve is a version locked form of the input, which may in turn
   be fed to the input of subcommands assets, get, release, and tags.
 
+  With -json, one json object is printed per release. With -format, each release is
+  printed using a go text/template, see https://godoc.org/text/template.
+  The fields are .Ident, .Tag, .State (draft, pre or full),
+  .Created, .Published and .URL.
+
 Parameter: ` + helpOrgPart + `<repo>[@<tag>]` + helpDefaultOrg + `
-  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.
+  The default tag is ` + defaultTag + `. Values of stable and edge are allowed.` + helpConstraint + `
+`,
+
+	// usage of the sync command
+	"sync": `Usage: %s %s [opts]
+
+  Install the tools of a lockfile into a directory, see lock. Tools which are
+  recorded in ` + installedName + ` at the locked tag and checksums, with all
+  of their files present, are not downloaded again. Every download must match
+  the locked checksum. Files of a previous install which a tool no longer
+  provides are removed.
+
+  It is an error if the lockfile does not match the manifest, when the
+  manifest is present. With -prune, tools installed in the directory which are
+  not in the lockfile are removed. With -n, the tools to sync or remove are
+  listed and nothing changes.
 `,
 
 	// usage of the tags command
@@ -2666,9 +8172,43 @@ Parameter: ` + helpOrgPart + `<repo>[@<tag>]` + helpDefaultOrg + `
   cause additional parameters to be read from standard input. Use the -a flag to
   list all tags including releases, pre-releases and unreleased tags.
 
+  With -json, one json object is printed per tag. With -format, each tag is
+  printed using a go text/template, see https://godoc.org/text/template.
+  The fields are .Ident, .Tag, .State (draft, pre, full or tag),
+  .Created, .Published and .URL.
+
 Parameter: ` + helpOrgPart + `<repo>` + helpDefaultOrg + `
 `,
 
+	// usage of the uninstall command
+	"uninstall": `Usage: %s %s [opts] <tool> [...]
+
+  Remove installed tools from a directory along with their record. A tool is
+  named by its repo, org/repo or the name of one of its installed files.
+  Directories made when extracting its archives are removed once empty.
+`,
+
+	// usage of the upgrade command
+	"upgrade": `Usage: %s %s [opts] [<tool>] [...]
+
+  Upgrade tools installed in a directory, or all of them if none are named.
+  The recorded source of each tool is resolved again, so a tag of latest,
+  stable, edge or a semver constraint may move to a new release. Tools with a
+  new release are downloaded and replace the installed files in place, and
+  files no longer provided by the release are removed. With -n the stale tools
+  are listed and nothing is installed.
+`,
+
+	// usage of the who command
+	"who": `Usage: %s %s [opts]
+
+  Print the login of the GitHub user that owns the token used by hubr.
+
+  With -json, a json object is printed. With -format, the user is printed
+  using a go text/template, see https://godoc.org/text/template. The fields
+  are .Login, .Name and .URL.
+`,
+
 	// usage of the what command
 	"what": `Usage: %s %s [opts] [<repo-file>] [...]
 
@@ -2681,5 +8221,8 @@ Parameter: <repo-file>
   exit success if any of the named files or directories have changed. With the
   -all flag hubr will only exit success if all of the named files or directories
   have changed.
+
+  With -tags the last release is the highest version tag reachable from head.
+  With -c the release and changes are of a component, see components.
 `,
 }
@@ -0,0 +1,1904 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/ulikunitz/xz"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestRetryAfter(t *testing.T) {
+	rsp := func(code int, h ...string) *http.Response {
+		r := &http.Response{StatusCode: code, Header: http.Header{}, Body: http.NoBody}
+		for i := 0; i+1 < len(h); i += 2 {
+			r.Header.Set(h[i], h[i+1])
+		}
+		return r
+	}
+	tests := []struct {
+		name   string
+		method string
+		rsp    *http.Response
+		wait   time.Duration // zero for a backoff
+		retry  bool
+	}{
+		{"ok", "GET", rsp(200), 0, false},
+		{"not found", "GET", rsp(404), 0, false},
+		{"server error", "GET", rsp(502), 0, true},
+		{"not implemented", "GET", rsp(501), 0, false},
+		{"server error post", "POST", rsp(502), 0, false},
+		{"retry after", "GET", rsp(503, "Retry-After", "7"), 7 * time.Second, true},
+		{"retry after post", "POST", rsp(503, "Retry-After", "7"), 7 * time.Second, false},
+		{"too many requests", "GET", rsp(429), 0, true},
+		{"too many requests post", "POST", rsp(429, "Retry-After", "3"), 3 * time.Second, true},
+		{"forbidden", "GET", rsp(403), 0, false},
+		{"secondary rate limit", "POST", rsp(403, "Retry-After", "60"), time.Minute, true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "https://api.github.com/", nil)
+		wait, retry := retryAfter(req, tt.rsp, nil, 1)
+		if retry != tt.retry {
+			t.Errorf("%s: retry %v, want %v", tt.name, retry, tt.retry)
+		}
+		if tt.wait != 0 && wait != tt.wait {
+			t.Errorf("%s: wait %s, want %s", tt.name, wait, tt.wait)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "https://api.github.com/", nil)
+	r := rsp(403)
+	r.Body = ioutil.NopCloser(strings.NewReader("You have exceeded a secondary rate limit"))
+	if wait, ok := retryAfter(req, r, nil, 1); !ok || wait != secondaryWait {
+		t.Errorf("secondary rate limit message: %s %v, want %s true", wait, ok, secondaryWait)
+	}
+	reset := time.Now().Add(time.Hour).Unix()
+	r = rsp(403, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+	if wait, ok := retryAfter(req, r, nil, 1); !ok || wait < 59*time.Minute {
+		t.Errorf("primary rate limit: %s %v, want about an hour", wait, ok)
+	}
+	if _, ok := retryAfter(req, nil, errors.New("connection reset"), 1); ok {
+		t.Error("network error of a post is retried")
+	}
+}
+
+func TestRetrierClonesRequest(t *testing.T) {
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "payload" {
+			t.Errorf("attempt %d: body %q", n, b)
+		}
+		if n++; n < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("payload"))
+	body := req.Body
+	rsp, err := retrier{http.DefaultTransport}.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || n != 3 {
+		t.Errorf("got %d after %d attempts, want 200 after 3", rsp.StatusCode, n)
+	}
+	if req.Body != body {
+		t.Error("the request body was replaced")
+	}
+}
+
+func TestVersionBump(t *testing.T) {
+	tests := []struct {
+		v    version
+		inc  increment
+		want string // empty for an error
+	}{
+		{"v1.2.3", major, "v2.0.0"},
+		{"v1.2.3", minor, "v1.3.0"},
+		{"v1.2.3", patch, "v1.2.4"},
+		{"v1.2.3+build.5", patch, "v1.2.4"},
+		{"v1.3.0-rc.1", major, "v2.0.0"},
+		{"v1.0.0-rc.1", major, "v1.0.0"},
+		{"v1.3.0-rc.1", minor, "v1.3.0"},
+		{"v1.3.1-rc.1", minor, "v1.4.0"},
+		{"v1.3.0-rc.1", patch, "v1.3.0"},
+		{"v1.2.3", prerelease, "v1.2.4-0"},
+		{"v1.2.4-0", prerelease, "v1.2.4-1"},
+		{"v1.2.4-beta.2.x", prerelease, "v1.2.4-beta.3.x"},
+		{"v1.2.4-beta", prerelease, "v1.2.4-beta.0"},
+		{"v1.2.3", rc, "v1.2.4-rc.1"},
+		{"v1.2.4-rc.1", rc, "v1.2.4-rc.2"},
+		{"v1.2.4-beta.2", rc, "v1.2.4-rc.1"},
+		{"v1.2.4-rc1", rc, ""},
+		{"v1.2.4-zeta", rc, ""},
+		{"v1.2.4-rc.1", final, "v1.2.4"},
+		{"1.2.3", patch, "1.2.4"},
+	}
+	for _, tt := range tests {
+		got, err := tt.v.bump(tt.inc)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s %s = %s, want an error", tt.v, tt.inc, got)
+		case tt.want != "" && err != nil:
+			t.Errorf("%s %s: %s", tt.v, tt.inc, err)
+		case tt.want != "" && string(got) != tt.want:
+			t.Errorf("%s %s = %s, want %s", tt.v, tt.inc, got, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// in increasing order of precedence, from the semver spec
+	vs := []version{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "v1.0.1", "1.1.0", "2.0.0"}
+	for i := range vs {
+		for j := range vs {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := vs[i].compare(vs[j]); got != want {
+				t.Errorf("compare(%s, %s) = %d, want %d", vs[i], vs[j], got, want)
+			}
+		}
+	}
+	if got := version("1.0.0+a").compare("v1.0.0+b"); got != 0 {
+		t.Errorf("build metadata and prefix are not ignored: %d", got)
+	}
+}
+
+func TestVersionIsPrerelease(t *testing.T) {
+	tests := []struct {
+		v    version
+		want bool
+	}{
+		{"1.2.3", false},
+		{"v1.2.3-rc.1", true},
+		{"1.2.3-0+build.5", true},
+		{"1.2.3+build.5", false},
+		{"v1.2.3-linux-amd64", true},
+		{"tool-1.2.3-linux-amd64", false},
+		{"1.2-beta", false},
+		{"v1-rc", false},
+		{"1.2.3-rc.1\n", true},
+	}
+	for _, tt := range tests {
+		if got := tt.v.isPrerelease(); got != tt.want {
+			t.Errorf("%q.isPrerelease() = %t, want %t", tt.v, got, tt.want)
+		}
+	}
+	if got := version("tool-1.2.3-linux").compare("tool-1.2.3-darwin"); got != 0 {
+		t.Errorf("suffixes are not ignored: %d", got)
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	tests := map[string]bool{
+		"":            false,
+		"latest":      false,
+		"v1":          false,
+		"1.4":         false,
+		"v1.4.2":      false,
+		"v1.4.2-rc.1": false,
+		"^1.4":        true,
+		"~2.3.1":      true,
+		">=1.0 <2.0":  true,
+		">=1.0,<2.0":  true,
+		"1.x":         true,
+		"1.4.*":       true,
+		"*":           true,
+		"1.4 || 2.x":  true,
+		"v2.X":        true,
+		"release-1.x": false,
+		"build.x":     false,
+		"1.rc.x":      false,
+		"x":           false,
+	}
+	for tag, want := range tests {
+		if got := isConstraint(tag); got != want {
+			t.Errorf("isConstraint(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		c     string
+		match []version
+		miss  []version
+	}{
+		{"^1.4", []version{"1.4.0", "v1.9.9"}, []version{"1.3.9", "2.0.0", "1.5.0-rc.1"}},
+		{"^0.6", []version{"0.6.0", "0.6.7"}, []version{"0.7.0", "0.5.9"}},
+		{"^0.0.3", []version{"0.0.3"}, []version{"0.0.4"}},
+		{"~2.3.1", []version{"2.3.1", "2.3.9"}, []version{"2.3.0", "2.4.0"}},
+		{"~2", []version{"2.0.0", "2.9.0"}, []version{"3.0.0"}},
+		{">=1.0 <2.0", []version{"1.0.0", "1.9.9"}, []version{"0.9.0", "2.0.0"}},
+		{">= 1.0, < 2", []version{"1.5.0"}, []version{"2.0.0"}},
+		{"<=1.4", []version{"1.4.9"}, []version{"1.5.0"}},
+		{">1.4", []version{"1.5.0"}, []version{"1.4.9"}},
+		{"=1.4.2", []version{"1.4.2"}, []version{"1.4.3"}},
+		{"1.x", []version{"1.0.0", "1.9.0"}, []version{"2.0.0"}},
+		{"1.4.*", []version{"1.4.0"}, []version{"1.5.0"}},
+		{"*", []version{"0.0.1", "9.0.0"}, []version{"1.0.0-beta"}},
+		{"1.4 || 2.x", []version{"1.4.3", "2.1.0"}, []version{"1.5.0", "3.0.0"}},
+		{"^2.0.0-0", []version{"2.0.0-beta.1", "2.1.0"}, []version{"1.9.0", "3.0.0"}},
+	}
+	for _, tt := range tests {
+		cs, err := parseConstraint(tt.c)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %s", tt.c, err)
+			continue
+		}
+		for _, v := range tt.match {
+			if !cs.match(v) {
+				t.Errorf("%q does not match %s", tt.c, v)
+			}
+		}
+		for _, v := range tt.miss {
+			if cs.match(v) {
+				t.Errorf("%q matches %s", tt.c, v)
+			}
+		}
+	}
+	for _, c := range []string{"^", "1.4 ||", ">=a.b", "~1.2.3.4"} {
+		if _, err := parseConstraint(c); err == nil {
+			t.Errorf("parseConstraint(%q) is not an error", c)
+		}
+	}
+}
+
+func TestParseSums(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("B", 64)
+	tests := []struct {
+		in   string
+		want sums
+		err  bool
+	}{
+		{"", sums{}, false},
+		{a + "  hubr-linux.zip\n" + b + " *hubr.exe\n\n", sums{"hubr-linux.zip": a, "hubr.exe": strings.ToLower(b)}, false},
+		{"  " + a + "  x  \n", sums{"x": a}, false},
+		{a + "\n", nil, true},
+		{"abc  x\n", nil, true},
+		{a + "  two words\n", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSums(strings.NewReader(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseSums(%q) is not an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSums(%q): %s", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseSums(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("parseSums(%q)[%s] = %s, want %s", tt.in, k, got[k], v)
+			}
+		}
+		if again, _ := parseSums(strings.NewReader(got.String())); len(again) != len(got) {
+			t.Errorf("%q does not round trip", got.String())
+		}
+	}
+}
+
+func TestUploadExistingAsset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, "remote")
+	}))
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	same, diff := filepath.Join(dir, "same"), filepath.Join(dir, "diff")
+	ioutil.WriteFile(same, []byte("remote"), 0644)
+	ioutil.WriteFile(diff, []byte("local!"), 0644)
+
+	u := upper{
+		c:    anonClient(),
+		id:   ident{org: "o", repo: "r", tag: "v1.0.0"},
+		as:   []github.ReleaseAsset{{ID: github.Int64(1), Name: github.String("a"), Size: github.Int(6)}},
+		sums: sums{},
+	}
+	if err := u.uploadFile("a", same); err != nil {
+		t.Errorf("same file: %s", err)
+	}
+	if err := u.uploadFile("a", diff); err == nil {
+		t.Error("a different file of the same size is taken for the asset")
+	}
+}
+
+func TestSelectPlatform(t *testing.T) {
+	as := func(ns ...string) []asset {
+		r := []asset{}
+		for _, n := range ns {
+			r = append(r, asset{ReleaseAsset: github.ReleaseAsset{Name: github.String(n)}})
+		}
+		return r
+	}
+	rel := as("tool_1.0_Linux_x86_64.tar.gz", "tool_1.0_Linux_arm64.tar.gz", "tool_1.0_Darwin_all.tar.gz",
+		"tool_1.0_windows_amd64.zip", "tool_1.0_windows_amd64.zip.sig", "SHA256SUMS", "tool_1.0_linux_x86_64.tar.gz.sha256")
+	tests := []struct {
+		as           []asset
+		goos, goarch string
+		want         string // empty for an error
+	}{
+		{rel, "linux", "amd64", "tool_1.0_Linux_x86_64.tar.gz"},
+		{rel, "linux", "arm64", "tool_1.0_Linux_arm64.tar.gz"},
+		{rel, "darwin", "arm64", "tool_1.0_Darwin_all.tar.gz"},
+		{rel, "windows", "amd64", "tool_1.0_windows_amd64.zip"},
+		{rel, "linux", "386", ""},
+		{rel, "freebsd", "amd64", ""},
+		{as("hubr-linux-amd64", "hubr-macos-amd64", "hubr-win64.exe"), "darwin", "amd64", "hubr-macos-amd64"},
+		{as("hubr-linux-amd64", "hubr-linux-amd64.tar.gz"), "linux", "amd64", ""},
+		{as("app-linux-aarch64", "app-linux-armv7"), "linux", "arm", "app-linux-armv7"},
+	}
+	for _, tt := range tests {
+		got, err := selectPlatform(ident{org: "o", repo: "r"}, tt.as, tt.goos, tt.goarch)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s/%s = %s, want an error", tt.goos, tt.goarch, got.GetName())
+		case tt.want != "" && err != nil:
+			t.Errorf("%s/%s: %s", tt.goos, tt.goarch, err)
+		case tt.want != "" && got.GetName() != tt.want:
+			t.Errorf("%s/%s = %s, want %s", tt.goos, tt.goarch, got.GetName(), tt.want)
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	const content = "hello world"
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dl" {
+			http.Redirect(w, r, "/dl", http.StatusFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		var off int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &off); err == nil {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		fmt.Fprint(w, content[off:])
+	}))
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	a := asset{
+		ReleaseAsset: github.ReleaseAsset{ID: github.Int64(7), Name: github.String("f"),
+			Size: github.Int(len(content)), UpdatedAt: &github.Timestamp{Time: updated}},
+		id: ident{org: "o", repo: "r", tag: "v1", asset: "f", dst: "f"},
+	}
+	// the partial of this asset is resumed, and that of a replaced asset is not
+	part := filepath.Join(dir, fmt.Sprintf(".f.7-11-%d.hubr-part", updated.Unix()))
+	stale := filepath.Join(dir, fmt.Sprintf(".f.7-11-%d.hubr-part", updated.Unix()-1))
+	ioutil.WriteFile(part, []byte("hel"), 0600)
+	ioutil.WriteFile(stale, []byte("XXXXXXXX"), 0600)
+
+	d := newDowner(anonClient(), 1, nil)
+	d.queue(dir, []asset{a})
+	if errs := d.wait(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "f")); string(b) != content {
+		t.Errorf("downloaded %q, want %q", b, content)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=3-" {
+		t.Errorf("requested ranges %q, want bytes=3-", ranges)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Error("the partial file is left behind")
+	}
+	if b, _ := ioutil.ReadFile(stale); string(b) != "XXXXXXXX" {
+		t.Error("the partial of a replaced asset was used")
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "real"), 0755)
+	os.Symlink(os.TempDir(), filepath.Join(dir, "link"))
+
+	tests := []struct {
+		name  string
+		strip int
+		want  string // relative to dir, "-" for an error
+	}{
+		{"bin/tool", 0, "bin/tool"},
+		{"tool-1.0/bin/tool", 1, "bin/tool"},
+		{"./tool-1.0/tool", 1, "tool"},
+		{"tool-1.0/", 1, ""},
+		{"tool-1.0", 1, ""},
+		{".", 0, ""},
+		{"a/../b", 0, "b"},
+		{`win\style\path`, 1, "style/path"},
+		{"../evil", 0, "-"},
+		{"a/../../evil", 0, "-"},
+		{"/etc/passwd", 0, "-"},
+		{`\windows\evil`, 0, "-"},
+		{"real/tool", 0, "real/tool"},
+		{"link/evil", 0, "-"},
+		{"x/link/evil", 1, "-"},
+	}
+	for _, tt := range tests {
+		got, err := entryPath(dir, tt.name, tt.strip)
+		switch {
+		case tt.want == "-":
+			if err == nil {
+				t.Errorf("entryPath(%q, %d) = %s, want an error", tt.name, tt.strip, got)
+			}
+		case err != nil:
+			t.Errorf("entryPath(%q, %d): %s", tt.name, tt.strip, err)
+		case tt.want == "" && got != "":
+			t.Errorf("entryPath(%q, %d) = %s, want nothing", tt.name, tt.strip, got)
+		case tt.want != "" && got != filepath.Join(dir, filepath.FromSlash(tt.want)):
+			t.Errorf("entryPath(%q, %d) = %s, want %s", tt.name, tt.strip, got, tt.want)
+		}
+	}
+}
+
+func TestInstallLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "bin"), 0755)
+
+	tests := []struct {
+		dst, link string
+		ok        bool
+	}{
+		{"bin/tool", "../lib/tool", true},
+		{"tool", "bin/tool", true},
+		{"bin/tool2", "tool", true},
+		{"bin/evil", "../../evil", false},
+		{"evil", "..", false},
+		{"evil2", "/etc/passwd", false},
+		{"evil3", "", false},
+		// d -> . is inside dir, but d/.. is then its parent on disk
+		{"d", ".", true},
+		{"e", "d/..", false},
+		{"bin/f", "../d/bin/tool", false},
+		{"g", "d", true},
+		{"h", "./bin/../tool", true},
+	}
+	for _, tt := range tests {
+		err := installLink(dir, filepath.Join(dir, filepath.FromSlash(tt.dst)), tt.link)
+		if (err == nil) != tt.ok {
+			t.Errorf("installLink(%s -> %s): %v, want ok %v", tt.dst, tt.link, err, tt.ok)
+		}
+	}
+}
+
+func TestParseLogEntry(t *testing.T) {
+	tests := []struct {
+		msg      string
+		typ      string
+		scope    string
+		breaking bool
+		subject  string
+		body     int
+		inc      increment
+	}{
+		{"fix bug", "", "", false, "fix bug", 0, patch},
+		{"feat: add x", "feat", "", false, "add x", 0, minor},
+		{"Feat(cli): add y\n\nmore words\nand more", "feat", "cli", false, "add y", 2, minor},
+		{"fix!: drop z", "fix", "", true, "drop z", 0, major},
+		{"refactor(api)!: rename", "refactor", "api", true, "rename", 0, major},
+		{"fix: a\n\nBREAKING CHANGE: b", "fix", "", true, "a", 1, major},
+		{"fix: a\r\n\r\nBREAKING-CHANGE: b\r\n", "fix", "", true, "a", 1, major},
+		{"fix: a\n\nsome BREAKING CHANGE: in prose\nnot a trailer", "fix", "", false, "a", 2, patch},
+		{"chore:no space", "", "", false, "chore:no space", 0, patch},
+		{"", "", "", false, "", 0, patch},
+	}
+	for _, tt := range tests {
+		e := parseLogEntry(tt.msg)
+		if e.Type != tt.typ || e.Scope != tt.scope || e.Breaking != tt.breaking || e.Subject != tt.subject || len(e.Body) != tt.body {
+			t.Errorf("parseLogEntry(%q) = %q %q %v %q %q", tt.msg, e.Type, e.Scope, e.Breaking, e.Subject, e.Body)
+		}
+		if inc := e.increment(); inc != tt.inc {
+			t.Errorf("parseLogEntry(%q).increment() = %s, want %s", tt.msg, inc, tt.inc)
+		}
+	}
+
+	e := parseLogEntry("feat: x\n\nbody\n\nSigned-off-by: a <a@b>\nRefs: #1\nRefs: #2")
+	if got := e.Trailers["Refs"]; len(got) != 2 || got[1] != "#2" || len(e.Trailers["Signed-off-by"]) != 1 {
+		t.Errorf("trailers %v", e.Trailers)
+	}
+
+	es := []logEntry{parseLogEntry("fix: a"), parseLogEntry("docs: b")}
+	if inc := conventionalIncrement(es); inc != patch {
+		t.Errorf("conventionalIncrement = %s, want patch", inc)
+	}
+	if inc := conventionalIncrement(append(es, parseLogEntry("feat: c"))); inc != minor {
+		t.Errorf("conventionalIncrement = %s, want minor", inc)
+	}
+	if inc := conventionalIncrement(nil); inc != patch {
+		t.Errorf("conventionalIncrement of nothing = %s, want patch", inc)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		path, kind string
+		want       string // empty for an error
+	}{
+		{"VERSION", "", "text"},
+		{"svc/package.json", "", "json"},
+		{"composer.json", "", "json"},
+		{"Cargo.toml", "", "cargo"},
+		{"py/pyproject.toml", "", "pyproject"},
+		{"charts/app/Chart.yaml", "", "chart"},
+		{"cmd/version.go", "", "go"},
+		{"other.toml", "", "text"},
+		{"VERSION", "json", "json"},
+		{"package.json", "text", "text"},
+		{"VERSION", "xml", ""},
+	}
+	for _, tt := range tests {
+		k, err := kindOf(tt.path, tt.kind)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("kindOf(%q, %q) = %s, want an error", tt.path, tt.kind, k.name)
+		case tt.want != "" && err != nil:
+			t.Errorf("kindOf(%q, %q): %s", tt.path, tt.kind, err)
+		case k.name != tt.want:
+			t.Errorf("kindOf(%q, %q) = %s, want %s", tt.path, tt.kind, k.name, tt.want)
+		}
+	}
+}
+
+func TestFindTOML(t *testing.T) {
+	find := findTOML("package", "workspace.package")
+	tests := []struct {
+		s, want string // want empty for no version
+	}{
+		{"[package]\nname = \"a\"\nversion = \"1.2.3\"\n", "1.2.3"},
+		{"[package]\nversion='1.2.3'", "1.2.3"},
+		{"version = \"0.0.1\"\n[package]\nversion = \"1.2.3\"\n", "1.2.3"},
+		{"[dependencies]\nversion = \"9.9.9\"\n[workspace.package]\nversion = \"1.2.3\"\n", "1.2.3"},
+		{"[workspace.package]\nversion = \"2.0.0\"\n[package]\nversion = \"1.2.3\"\n", "1.2.3"},
+		{"[package]\nname = \"a\"\n[[bin]]\nversion = \"9.9.9\"\n", ""},
+		{"[package]\n# version = \"9.9.9\"\n", ""},
+		{"[ package ]\n  version = \"1.2.3\"", "1.2.3"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		i, j := find(tt.s)
+		switch {
+		case tt.want == "" && i >= 0:
+			t.Errorf("find(%q) = %q, want none", tt.s, tt.s[i:j])
+		case tt.want != "" && i < 0:
+			t.Errorf("find(%q) found none, want %q", tt.s, tt.want)
+		case tt.want != "" && tt.s[i:j] != tt.want:
+			t.Errorf("find(%q) = %q, want %q", tt.s, tt.s[i:j], tt.want)
+		}
+	}
+}
+
+func TestVersionKindReplace(t *testing.T) {
+	tests := []struct {
+		kind, s, want string // want empty for an error
+	}{
+		{"text", "1.2.3\n", "2.0.0\n"},
+		{"text", "1.2.3", "2.0.0"},
+		{"json", `{"name": "a", "version": "1.2.3"}`, `{"name": "a", "version": "2.0.0"}`},
+		{"json", "{\n  \"dependencies\": {\"b\": {\"version\": \"9.9.9\"}},\n  \"version\" : \"1.2.3\"\n}\n",
+			"{\n  \"dependencies\": {\"b\": {\"version\": \"9.9.9\"}},\n  \"version\" : \"2.0.0\"\n}\n"},
+		{"json", `{"description": "\"version\": \"9.9.9\"", "version": "1.2.3"}`,
+			`{"description": "\"version\": \"9.9.9\"", "version": "2.0.0"}`},
+		{"json", `{"config": {"version": "9.9.9"}}`, ""},
+		{"json", `{"version": 1}`, ""},
+		{"json", `["version", "1.2.3"]`, ""},
+		{"json", `not json`, ""},
+		{"cargo", "[package]\nversion = \"1.2.3\"\n", "[package]\nversion = \"2.0.0\"\n"},
+		{"chart", "apiVersion: v2\nversion: 1.2.3 # app\nappVersion: 9.9.9\n", "apiVersion: v2\nversion: 2.0.0 # app\nappVersion: 9.9.9\n"},
+		{"chart", "version: \"1.2.3\"\n", "version: \"2.0.0\"\n"},
+		{"go", "package main\n\nconst Version = \"1.2.3\"\n", "package main\n\nconst Version = \"2.0.0\"\n"},
+		{"go", "package main\n\nvar Version = \"1.2.3\"\n", "package main\n\nvar Version = \"2.0.0\"\n"},
+		{"go", "package main\n\nconst (\n\tVersion string = \"1.2.3\"\n)\n", "package main\n\nconst (\n\tVersion string = \"2.0.0\"\n)\n"},
+		{"go", "package main\n\nvar AppVersion = \"1.2.3\"\n", ""},
+	}
+	for _, tt := range tests {
+		got, err := versionKinds[tt.kind].replace(tt.s, version("2.0.0"))
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s replace(%q) = %q, want an error", tt.kind, tt.s, got)
+		case tt.want != "" && err != nil:
+			t.Errorf("%s replace(%q): %s", tt.kind, tt.s, err)
+		case got != tt.want:
+			t.Errorf("%s replace(%q) = %q, want %q", tt.kind, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64 // negative for an error
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"10k", 10 << 10},
+		{"10K", 10 << 10},
+		{"10KB", 10 << 10},
+		{"10KiB", 10 << 10},
+		{"2m", 2 << 20},
+		{" 1G ", 1 << 30},
+		{"3TiB", 3 << 40},
+		{"100b", 100},
+		{"", -1},
+		{"G", -1},
+		{"1.5G", -1},
+		{"-1", -1},
+		{"10X", -1},
+		{"1KM", -1},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		switch {
+		case tt.want < 0 && err == nil:
+			t.Errorf("parseSize(%q) = %d, want an error", tt.s, got)
+		case tt.want >= 0 && err != nil:
+			t.Errorf("parseSize(%q): %s", tt.s, err)
+		case tt.want >= 0 && got != tt.want:
+			t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCopy(t *testing.T) {
+	const content = "hello world"
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { cacheDir = d }(cacheDir)
+	cacheDir = dir
+
+	s := sha256.Sum256([]byte(content))
+	sum := hex.EncodeToString(s[:])
+	a := asset{ReleaseAsset: github.ReleaseAsset{ID: github.Int64(7), Size: github.Int(len(content))}}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		blob   string // empty for none
+		cached bool
+		want   string
+	}{
+		{content, true, content},
+		{"hello there", false, "hello"},
+		{"hello", false, "hello"},
+		{"", false, "hello"},
+	}
+	for _, tt := range tests {
+		os.Remove(cacheBlob(sum))
+		if tt.blob != "" {
+			if err := ioutil.WriteFile(cacheBlob(sum), []byte(tt.blob), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := ioutil.TempFile(dir, "part-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(f, "hello")
+		cached := cacheCopy(a, sum, f)
+		f.Close()
+
+		b, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached != tt.cached || string(b) != tt.want {
+			t.Errorf("blob %q: cached %t with %q, want %t with %q", tt.blob, cached, b, tt.cached, tt.want)
+		}
+		if _, err := os.Stat(cacheBlob(sum)); tt.blob != "" && !tt.cached && !os.IsNotExist(err) {
+			t.Errorf("blob %q was not removed", tt.blob)
+		}
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { cacheDir = d }(cacheDir)
+	cacheDir = dir
+
+	old := time.Now().Add(-time.Hour)
+	write := func(p, s string, age int) {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		at := old.Add(time.Duration(age) * time.Minute)
+		os.Chtimes(p, at, at)
+	}
+	e := cacheEntry{ID: 1, Size: 10, Updated: old, SHA256: "aaaa"}
+	write(filepath.Join("keys", filepath.Base(e.key())), `{"asset":"o/r@v1:a","id":1,"size":10,"sha256":"aaaa"}`, 0)
+	write(filepath.Join("blobs", "aaaa"), "0123456789", 2)
+	write(filepath.Join("http", "old.json"), `{"url":"https://api/old"}`, 1)
+	write(filepath.Join("http", "new.json"), `{"url":"https://api/new"}`, 3)
+
+	ls := func() []string {
+		var r []string
+		es, _ := cacheEntries()
+		hs, _ := cacheHTTPEntries()
+		for _, e := range append(es, hs...) {
+			r = append(r, e.Kind+" "+e.Asset)
+		}
+		return r
+	}
+	if got, want := strings.Join(ls(), ","), "asset o/r@v1:a,api https://api/old,api https://api/new"; got != want {
+		t.Fatalf("entries %s, want %s", got, want)
+	}
+
+	if err := cacheEvict(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(ls()); got != 3 {
+		t.Errorf("unlimited evicted %d of 3 entries", 3-got)
+	}
+	// the api response used least recently goes first
+	if err := cacheEvict(40); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(ls(), ","), "asset o/r@v1:a,api https://api/new"; got != want {
+		t.Errorf("entries %s, want %s", got, want)
+	}
+	if err := cacheEvict(30); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(ls(), ","), "api https://api/new"; got != want {
+		t.Errorf("entries %s, want %s", got, want)
+	}
+}
+
+func TestCacherEvictsOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Etag", `"`+r.URL.Path+`"`)
+		fmt.Fprintf(w, `{"path": %q}`, r.URL.Path)
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string, n int64) { cacheDir, cacheMax, httpSaved = d, n, 0 }(cacheDir, cacheMax)
+	cacheDir, cacheMax = dir, 1
+
+	// responses over the maximum size are kept until the command is done
+	c := &http.Client{Transport: cacher{http.DefaultTransport}}
+	for _, p := range []string{"/a", "/b"} {
+		rsp, err := c.Get(srv.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+	}
+	if hs, _ := cacheHTTPEntries(); len(hs) != 2 {
+		t.Fatalf("cached %d responses, want 2", len(hs))
+	}
+	cacheEvictSaved()
+	if hs, _ := cacheHTTPEntries(); len(hs) != 0 {
+		t.Errorf("kept %d responses over the maximum size", len(hs))
+	}
+}
+
+func TestSplitChain(t *testing.T) {
+	tests := []struct {
+		chain string
+		want  []string
+	}{
+		{"env:A", []string{"env:A"}},
+		{"env:A,file:b", []string{"env:A", "file:b"}},
+		{`exec:cut -d\, -f1 f,env:A`, []string{"exec:cut -d, -f1 f", "env:A"}},
+		{`exec:printf 'a\n'`, []string{`exec:printf 'a\n'`}},
+		{`exec:a\\,env:A`, []string{`exec:a\,env:A`}},
+		{`env:A\`, []string{`env:A\`}},
+		{"env:A,", []string{"env:A", ""}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		got := splitChain(tt.chain)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("splitChain(%q) = %q, want %q", tt.chain, got, tt.want)
+		}
+	}
+}
+
+// setenv sets the environment variables of kvs, unsetting those with empty
+// values, and returns a function restoring them.
+func setenv(kvs ...string) func() {
+	var undo []func()
+	for i := 0; i+1 < len(kvs); i += 2 {
+		k, v := kvs[i], kvs[i+1]
+		if old, ok := os.LookupEnv(k); ok {
+			undo = append(undo, func() { os.Setenv(k, old) })
+		} else {
+			undo = append(undo, func() { os.Unsetenv(k) })
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+	return func() {
+		for _, f := range undo {
+			f()
+		}
+	}
+}
+
+func TestActionsArgs(t *testing.T) {
+	tests := []struct {
+		actions, ref string
+		args         []string
+		tag          bool
+		want         []string
+	}{
+		{"true", "refs/heads/main", nil, false, []string{"o/r"}},
+		{"true", "refs/heads/main", []string{"."}, false, []string{"o/r"}},
+		{"true", "refs/heads/main", []string{".", "a.zip"}, false, []string{"o/r", "a.zip"}},
+		{"true", "refs/heads/main", []string{"x/y", "a.zip"}, false, []string{"x/y", "a.zip"}},
+		{"true", "refs/heads/main", []string{"main.go"}, false, []string{"main.go"}},
+		{"true", "refs/heads/main", []string{"@v1.0.0"}, false, []string{"@v1.0.0"}},
+		{"true", "refs/heads/main", []string{"@v1.0.0", "a.zip"}, true, []string{"o/r@v1.0.0", "a.zip"}},
+		{"true", "refs/heads/main", nil, true, nil},
+		{"true", "refs/heads/main", []string{".", "a.zip"}, true, []string{".", "a.zip"}},
+		{"true", "refs/tags/v1.0.0", nil, true, []string{"o/r@v1.0.0"}},
+		{"true", "refs/tags/v1.0.0", []string{".", "a.zip"}, true, []string{"o/r@v1.0.0", "a.zip"}},
+		{"true", "refs/tags/v1.0.0", []string{"main.go"}, true, []string{"main.go"}},
+		{"true", "refs/tags/v1.0.0", []string{"x/y@v2", "a.zip"}, true, []string{"x/y@v2", "a.zip"}},
+		{"", "refs/tags/v1.0.0", []string{"."}, true, []string{"."}},
+		{"", "refs/tags/v1.0.0", nil, false, nil},
+	}
+	for _, tt := range tests {
+		restore := setenv("GITHUB_ACTIONS", tt.actions, "GITHUB_REPOSITORY", "o/r", "GITHUB_REF", tt.ref)
+		got := actionsArgs(tt.args, tt.tag)
+		restore()
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("actions %q ref %s: actionsArgs(%q, %t) = %q, want %q", tt.actions, tt.ref, tt.args, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestSetOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "output")
+
+	tests := []struct {
+		actions string
+		kvs     []string
+		want    string
+	}{
+		{"", []string{"a", "1"}, ""},
+		{"true", nil, ""},
+		{"true", []string{"a", "1", "b", ""}, "a=1\nb=\n"},
+		{"true", []string{"url", "https://x/y?a=b=c"}, "url=https://x/y?a=b=c\n"},
+		{"true", []string{"urls", "u1\nu2"}, "urls<<hubr_DELIM\nu1\nu2\nhubr_DELIM\n"},
+		{"true", []string{"cr", "a\r\nb", "c", "d"}, "cr<<hubr_DELIM\na\r\nb\nhubr_DELIM\nc=d\n"},
+		{"true", []string{"odd"}, ""},
+	}
+	for _, tt := range tests {
+		os.Remove(p)
+		restore := setenv("GITHUB_ACTIONS", tt.actions, "GITHUB_OUTPUT", p)
+		err := setOutputs(tt.kvs...)
+		restore()
+		if err != nil {
+			t.Errorf("setOutputs(%q): %s", tt.kvs, err)
+			continue
+		}
+		b, _ := ioutil.ReadFile(p)
+		got := string(b)
+		if i := strings.Index(got, "<<hubr_"); i >= 0 {
+			d := got[i+2 : i+2+strings.IndexByte(got[i+2:], '\n')]
+			if strings.Contains(strings.Join(tt.kvs, "\n"), d) {
+				t.Errorf("setOutputs(%q): delimiter %s is in a value", tt.kvs, d)
+			}
+			got = strings.Replace(got, d, "hubr_DELIM", -1)
+		}
+		if got != tt.want {
+			t.Errorf("setOutputs(%q) wrote %q, want %q", tt.kvs, got, tt.want)
+		}
+	}
+
+	// outputs of several calls are appended
+	defer setenv("GITHUB_ACTIONS", "true", "GITHUB_OUTPUT", p)()
+	os.Remove(p)
+	setOutputs("a", "1")
+	setOutputs("b", "2")
+	if b, _ := ioutil.ReadFile(p); string(b) != "a=1\nb=2\n" {
+		t.Errorf("appended outputs %q, want %q", b, "a=1\nb=2\n")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeKeys := func(name string, bs ...[]byte) string {
+		p := filepath.Join(dir, name)
+		s := "# hubr key\n\n"
+		for _, b := range bs {
+			s += base64.StdEncoding.EncodeToString(b) + "\n"
+		}
+		if err := ioutil.WriteFile(p, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+
+	key, err := loadSigningKey(writeKeys("key", priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := loadTrustedKeys(writeKeys("key.pub", other, pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, err := loadTrustedKeys(writeKeys("other.pub", other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSigningKey(writeKeys("pub", pub)); err == nil {
+		t.Error("a public key is loaded as a signing key")
+	}
+	if _, err := loadTrustedKeys(writeKeys("priv.pub", priv)); err == nil {
+		t.Error("a private key is loaded as a trusted key")
+	}
+	if _, err := loadTrustedKeys(writeKeys("empty.pub")); err == nil {
+		t.Error("a key file without keys is loaded")
+	}
+	if k, err := loadSigningKey(""); k != nil || err != nil {
+		t.Errorf("no signing key = %v, %v", k, err)
+	}
+
+	b := []byte("asset contents")
+	h := sha256.Sum256(b)
+	sig := sign(key, "v1.2.0", "tool.zip", b)
+	p := filepath.Join(dir, "tool.zip")
+	ioutil.WriteFile(p, b, 0644)
+	if fsig, err := signFile(key, "v1.2.0", "tool.zip", p); err != nil || string(fsig) != string(sig) {
+		t.Errorf("signFile = %q, %v, want %q", fsig, err, sig)
+	}
+
+	tests := []struct {
+		keys      []ed25519.PublicKey
+		tag, name string
+		h         []byte
+		sig       []byte
+		ok        bool
+	}{
+		{trusted, "v1.2.0", "tool.zip", h[:], sig, true},
+		{untrusted, "v1.2.0", "tool.zip", h[:], sig, false},
+		{nil, "v1.2.0", "tool.zip", h[:], sig, false},
+		{trusted, "v1.3.0", "tool.zip", h[:], sig, false},
+		{trusted, "v1.2.0", "other.zip", h[:], sig, false},
+		{trusted, "v1.2.0", "tool.zip", make([]byte, sha256.Size), sig, false},
+		{trusted, "v1.2.0", "tool.zip", h[:], []byte("not a signature\n"), false},
+		{trusted, "v1.2.0", "tool.zip", h[:], sig[:len(sig)-8], false},
+	}
+	for i, tt := range tests {
+		if err := verify(tt.keys, tt.tag, tt.name, tt.h, tt.sig); (err == nil) != tt.ok {
+			t.Errorf("%d: verify %s %s = %v, want ok %t", i, tt.tag, tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestPutSumsWithoutKey(t *testing.T) {
+	const manifest = "0000000000000000000000000000000000000000000000000000000000000000  a\n"
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/releases/1/assets"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `[{"id": 2, "name": "SHA256SUMS", "size": %d}, {"id": 3, "name": "SHA256SUMS.sig", "size": 89}]`, len(manifest))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/releases/assets/2"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, manifest)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": 4, "name": "SHA256SUMS"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+
+	id := ident{org: "o", repo: "r", tag: "v1.0.0"}
+	r := &github.RepositoryRelease{ID: github.Int64(1), TagName: github.String("v1.0.0")}
+	c := anonClient()
+
+	// an unchanged manifest and its signature are kept
+	calls = nil
+	if err := c.PutSums(id, r, sums{"a": strings.Repeat("0", 64)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range calls {
+		if !strings.HasPrefix(call, "GET ") {
+			t.Errorf("unchanged manifest: %s", call)
+		}
+	}
+
+	// a changed manifest is replaced and its old signature deleted
+	calls = nil
+	if err := c.PutSums(id, r, sums{"b": strings.Repeat("1", 64)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	deleted := map[string]bool{}
+	for _, call := range calls {
+		if strings.HasPrefix(call, "DELETE ") {
+			deleted[call[strings.LastIndexByte(call, '/')+1:]] = true
+		}
+	}
+	if !deleted["2"] || !deleted["3"] {
+		t.Errorf("changed manifest: deleted %v, want the manifest 2 and signature 3 in %q", deleted, calls)
+	}
+}
+
+func TestInstallArchive(t *testing.T) {
+	// tool/bin/tool, mode 0755, and tool/README, mode 0644, bzip2 compressed
+	bz2Tar, _ := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWUugHVMAAKN/gcuQAIBoAP+AJgIaAH5nngAACAgIIACUhKUxQ9Q0A00D0Q/SIeTUEkqGjTTEZNqMATTE0M19+Yzew3NgAZ5JCHHwc6AOE0ZAPiEMBjHByfbacelX46msEeVAgqtEION/Zll9vMfe5sHaM8PPtVV4eJjRmMljPvJZEUniOam1KzDdkVjKZULBINhdyRThQkEugHVM")
+	// a script echoing hi, bzip2 compressed
+	bz2Bin, _ := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWY9NzvcAAAJRgAAQaACaYYgAIAAimAGQgGgDMEvIsOdOkrfC7kinChIR6bne4A==")
+	const script = "#!/bin/sh\necho hi\n"
+
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	for _, e := range []struct {
+		name string
+		mode int64
+		body string
+	}{{"tool/bin/tool", 0755, script}, {"tool/README", 0644, "readme\n"}} {
+		tw.WriteHeader(&tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.body)), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR})
+		io.WriteString(tw, e.body)
+	}
+	tw.Close()
+	compress := func(t string, b []byte) []byte {
+		var buf bytes.Buffer
+		switch t {
+		case "application/x-gzip":
+			w := gzip.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+		case "application/x-xz":
+			w, _ := xz.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		t, name string
+		b       []byte
+		x       extraction
+		want    map[string]os.FileMode // installed paths and made directories, and their modes
+	}{
+		{"application/x-gzip", "tool.tar.gz", compress("application/x-gzip", tb.Bytes()), extraction{},
+			map[string]os.FileMode{"tool": 0755, "tool/bin": 0755, "tool/bin/tool": 0755}},
+		{"application/x-xz", "tool.tar.xz", compress("application/x-xz", tb.Bytes()), extraction{strip: 2},
+			map[string]os.FileMode{"tool": 0755}},
+		{"application/x-bzip2", "tool.tbz", bz2Tar, extraction{all: true, strip: 1},
+			map[string]os.FileMode{"bin": 0755, "bin/tool": 0755, "README": 0644}},
+		{"application/x-gzip", "tool.gz", compress("application/x-gzip", []byte(script)), extraction{},
+			map[string]os.FileMode{"tool": 0755}},
+		{"application/x-xz", "tool-linux.xz", compress("application/x-xz", []byte(script)), extraction{},
+			map[string]os.FileMode{"tool-linux": 0755}},
+		{"application/x-bzip2", "tool.bz2", bz2Bin, extraction{},
+			map[string]os.FileMode{"tool": 0755}},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "hubr-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src := filepath.Join(dir, "."+tt.name)
+		ioutil.WriteFile(src, tt.b, 0644)
+
+		ps, err := installArchive(src, filepath.Join(dir, tt.name), dir, tt.t, tt.x, 0755)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		got := map[string]os.FileMode{}
+		for _, p := range ps {
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+				continue
+			}
+			rel, _ := filepath.Rel(dir, p)
+			got[filepath.ToSlash(rel)] = fi.Mode().Perm()
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: installed %v, want %v", tt.name, got, tt.want)
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "tool")); err == nil && string(b) != script {
+			t.Errorf("%s: tool is %q, want %q", tt.name, b, script)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "bad.gz")
+	ioutil.WriteFile(src, []byte("not gzip"), 0644)
+	if _, err := installArchive(src, filepath.Join(dir, "bad"), dir, "application/x-gzip", extraction{}, 0755); err == nil {
+		t.Error("a corrupt archive is installed")
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, p := range []string{"a", "share/a/a.txt", "share/b/b.txt", "keep/x", "b"} {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(p), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "empty"), 0755)
+	is := []installation{
+		{Source: "o/a@v1:a", Tag: "v1", Dirs: []string{"share", "share/a"},
+			Assets: []installedAsset{{Name: "a.tgz", Paths: []string{"a", "share/a/a.txt"}}}},
+		{Source: "o/b@v1:b", Tag: "v1", Dirs: []string{"share/b"},
+			Assets: []installedAsset{{Name: "b.tgz", Paths: []string{"b", "share/b/b.txt"}}}},
+	}
+	if err := saveInstalled(dir, is); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(p string) bool {
+		_, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(p)))
+		return err == nil
+	}
+	if err := uninstall([]string{"-d", dir, "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{"a": false, "share/a": false, "share": true, "share/b/b.txt": true, "b": true, "keep/x": true, "empty": true} {
+		if exists(p) != want {
+			t.Errorf("after uninstall a, %s exists %t, want %t", p, !want, want)
+		}
+	}
+
+	// the shared directory made by a goes once b's files are gone
+	if err := uninstall([]string{"-d", dir, "o/b"}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{"share": false, "b": false, "keep/x": true, "empty": true} {
+		if exists(p) != want {
+			t.Errorf("after uninstall b, %s exists %t, want %t", p, !want, want)
+		}
+	}
+	if is, err := loadInstalled(dir); err != nil || len(is) != 0 {
+		t.Errorf("installed after uninstall = %v, %v", is, err)
+	}
+	if err := uninstall([]string{"-d", dir, "a"}); err == nil {
+		t.Error("uninstall of a tool which is not installed")
+	}
+}
+
+func TestMergeInstalled(t *testing.T) {
+	old := []installation{
+		{Source: "o/a@v1:a", Tag: "v1", Dirs: []string{"lib"},
+			Assets: []installedAsset{{Name: "a", Paths: []string{"a", "lib/a.so"}}}},
+		{Source: "o/b@v1:b", Tag: "v1",
+			Assets: []installedAsset{{Name: "b", Paths: []string{"b", "shared"}}}},
+		{Source: "o/c@v1:c", Tag: "v1",
+			Assets: []installedAsset{{Name: "c", Paths: []string{"c"}}}},
+	}
+	is := []installation{
+		{Source: "o/a@v1:a", Tag: "v2", Dirs: []string{"doc"},
+			Assets: []installedAsset{{Name: "a", Paths: []string{"a", "doc/a.1"}}}},
+		{Source: "o/d@v1:d", Tag: "v1",
+			Assets: []installedAsset{{Name: "d", Paths: []string{"d", "shared", "c"}}}},
+	}
+	got := mergeInstalled(old, is)
+	want := map[string]string{
+		"o/a@v1:a": "v2 [a doc/a.1] [doc lib]",
+		"o/d@v1:d": "v1 [d shared c] []",
+		"o/b@v1:b": "v1 [b] []",
+	}
+	if len(got) != len(want) {
+		t.Errorf("merged %d installations, want %d: %v", len(got), len(want), got)
+	}
+	for _, in := range got {
+		if s := fmt.Sprintf("%s %v %v", in.Tag, in.paths(), in.Dirs); s != want[in.Source] {
+			t.Errorf("%s = %s, want %s", in.Source, s, want[in.Source])
+		}
+	}
+}
+
+func TestDownloadShortBody(t *testing.T) {
+	const content = "hello world"
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dl" {
+			http.Redirect(w, r, "/dl", http.StatusFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		var off int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &off); err == nil {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		// each response ends cleanly after at most 4 bytes
+		end := off + 4
+		if end > len(content) {
+			end = len(content)
+		}
+		fmt.Fprint(w, content[off:end])
+	}))
+	defer srv.Close()
+	defer func(u, d string, n int) { githubURL, cacheDir, retries = u, d, n }(githubURL, cacheDir, retries)
+	githubURL, cacheDir = srv.URL, ""
+
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := asset{
+		ReleaseAsset: github.ReleaseAsset{ID: github.Int64(7), Name: github.String("f"),
+			Size: github.Int(len(content)), UpdatedAt: &github.Timestamp{Time: time.Unix(1, 0)}},
+		id: ident{org: "o", repo: "r", tag: "v1", asset: "f", dst: "f"},
+	}
+	part := filepath.Join(dir, ".f.7-11-1.hubr-part")
+
+	// too few attempts keep the partial download for the next run
+	retries = 2
+	d := newDowner(anonClient(), 1, nil)
+	d.queue(dir, []asset{a})
+	if errs := d.wait(); len(errs) == 0 {
+		t.Fatal("a short download succeeded")
+	}
+	if b, _ := ioutil.ReadFile(part); string(b) != "hello wo" {
+		t.Errorf("kept partial %q, want %q", b, "hello wo")
+	}
+
+	ranges = nil
+	d = newDowner(anonClient(), 1, nil)
+	d.queue(dir, []asset{a})
+	if errs := d.wait(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "f")); string(b) != content {
+		t.Errorf("downloaded %q, want %q", b, content)
+	}
+	if fmt.Sprint(ranges) != "[bytes=8-]" {
+		t.Errorf("requested ranges %q, want bytes=8-", ranges)
+	}
+}
+
+func TestExtractGot(t *testing.T) {
+	const script = "#!/bin/sh\necho hi\n"
+	gz := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: "pkg/tool", Mode: 0755, Size: int64(len(script)), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR})
+	io.WriteString(tw, script)
+	tw.Close()
+
+	tests := []struct {
+		name string
+		b    []byte
+		want map[string]os.FileMode // the files left in dir and their modes
+	}{
+		{"tool", gz([]byte(script)), map[string]os.FileMode{"tool": 0644}},
+		{"tool.gz", gz([]byte(script)), map[string]os.FileMode{"tool": 0644}},
+		{"pkg.tar.gz", gz(tb.Bytes()), map[string]os.FileMode{"pkg/tool": 0755}},
+		{"notes.txt", []byte("plain text\n"), map[string]os.FileMode{"notes.txt": 0644}},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "hubr-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, tt.name), tt.b, 0644)
+
+		if err := extractGot(filepath.Join(dir, tt.name), dir, extraction{all: true}); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		got := map[string]os.FileMode{}
+		filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				rel, _ := filepath.Rel(dir, p)
+				got[filepath.ToSlash(rel)] = fi.Mode().Perm()
+			}
+			return nil
+		})
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: left %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.name == "tool" {
+			if b, _ := ioutil.ReadFile(filepath.Join(dir, "tool")); string(b) != script {
+				t.Errorf("%s: decompressed %q, want %q", tt.name, b, script)
+			}
+		}
+	}
+}
+
+// testRepo makes a git repository in a temporary directory and changes to it.
+// Each commit writes its files and is tagged with its tags, annotated if the
+// tag name ends with !. It returns the commits and a function which changes
+// back and removes the repository.
+func testRepo(t *testing.T, commits ...testCommit) ([]*object.Commit, func()) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	sig := &object.Signature{Name: "hubr", Email: "hubr@example.com", When: time.Unix(1e9, 0)}
+	cs := []*object.Commit{}
+	for i, c := range commits {
+		for p, s := range c.files {
+			p = filepath.Join(dir, filepath.FromSlash(p))
+			os.MkdirAll(filepath.Dir(p), 0755)
+			if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+				cleanup()
+				t.Fatal(err)
+			}
+		}
+		if _, err := w.Add("."); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		sig.When = sig.When.Add(time.Minute)
+		h, err := w.Commit(fmt.Sprintf("commit %d", i), &git.CommitOptions{Author: sig, Committer: sig})
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		for _, tag := range c.tags {
+			var opts *git.CreateTagOptions
+			if strings.HasSuffix(tag, "!") {
+				tag = strings.TrimSuffix(tag, "!")
+				opts = &git.CreateTagOptions{Tagger: sig, Message: tag}
+			}
+			if _, err := r.CreateTag(tag, h, opts); err != nil {
+				cleanup()
+				t.Fatal(err)
+			}
+		}
+		c, err := r.CommitObject(h)
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		cs = append(cs, c)
+	}
+	if err := os.Chdir(dir); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return cs, cleanup
+}
+
+// testCommit is a commit of testRepo.
+type testCommit struct {
+	files map[string]string
+	tags  []string
+}
+
+func TestVersionTagRx(t *testing.T) {
+	tests := map[string]bool{
+		"v1.2.3":         true,
+		"1.2.3":          true,
+		"v1.2.3-rc.1":    true,
+		"v1.2.3+build.7": true,
+		"1.2.3-0+b":      true,
+		"v1":             false,
+		"v1.2":           false,
+		"2024":           false,
+		"123":            false,
+		"latest":         false,
+		"release-1.2.3":  false,
+		"v1.2.3-":        false,
+		"v1.2.3.4":       false,
+		"svc-a/v1.2.3":   false,
+	}
+	for tag, want := range tests {
+		if got := versionTagRx.MatchString(tag); got != want {
+			t.Errorf("versionTagRx.MatchString(%q) = %t, want %t", tag, got, want)
+		}
+	}
+}
+
+func TestTagVersioner(t *testing.T) {
+	cs, cleanup := testRepo(t,
+		testCommit{map[string]string{"a": "1"}, []string{"v1.0.0"}},
+		testCommit{map[string]string{"a": "2"}, []string{"v2", "2024", "svc-a/v3.0.0"}},
+		testCommit{map[string]string{"a": "3"}, []string{"v1.1.0-rc.1!"}},
+		testCommit{map[string]string{"a": "4"}, []string{"latest", "v1.2"}},
+	)
+	defer cleanup()
+
+	tests := []struct {
+		prefix string
+		want   []version // the version at each commit
+	}{
+		{"", []version{"v1.0.0", "v1.0.0", "v1.1.0-rc.1", "v1.1.0-rc.1"}},
+		{"svc-a/", []version{"", "v3.0.0", "v3.0.0", "v3.0.0"}},
+		{"svc-b/", []version{"", "", "", ""}},
+	}
+	for _, tt := range tests {
+		vr, err := newTagVersioner(tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range cs {
+			if v, err := vr.at(c); err != nil || v != tt.want[i] {
+				t.Errorf("prefix %q: version at commit %d = %q, %v, want %q", tt.prefix, i, v, err, tt.want[i])
+			}
+		}
+		if v, err := vr.head(); err != nil || v != tt.want[len(cs)-1] {
+			t.Errorf("prefix %q: head = %q, %v, want %q", tt.prefix, v, err, tt.want[len(cs)-1])
+		}
+	}
+}
+
+func TestVersionerOwns(t *testing.T) {
+	tests := []struct {
+		paths []string
+		p     string
+		want  bool
+	}{
+		{nil, "a/b", true},
+		{nil, "", false},
+		{[]string{"svc-a", "lib"}, "svc-a/main.go", true},
+		{[]string{"svc-a", "lib"}, "lib", true},
+		{[]string{"svc-a", "lib"}, "svc-ab/main.go", false},
+		{[]string{"svc-a", "lib"}, "svc-b/main.go", false},
+		{[]string{"svc-a", "lib"}, "", false},
+		{[]string{"."}, "README.md", true},
+		{[]string{"svc-a/cmd"}, "svc-a/main.go", false},
+	}
+	for _, tt := range tests {
+		if got := (versioner{paths: tt.paths}).owns(tt.p); got != tt.want {
+			t.Errorf("paths %q: owns(%q) = %t, want %t", tt.paths, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestVersionerTouching(t *testing.T) {
+	cs, cleanup := testRepo(t,
+		testCommit{files: map[string]string{"svc-a/VERSION": "1.0.0", "svc-b/VERSION": "1.0.0"}},
+		testCommit{files: map[string]string{"svc-b/main.go": "b"}},
+		testCommit{files: map[string]string{"lib/lib.go": "l"}},
+		testCommit{files: map[string]string{"svc-a/main.go": "a"}},
+		testCommit{files: map[string]string{"README.md": "r"}},
+	)
+	defer cleanup()
+
+	tests := []struct {
+		paths []string
+		want  []int // the commits touching the paths
+	}{
+		{nil, []int{0, 1, 2, 3, 4}},
+		{[]string{"svc-a", "lib"}, []int{0, 2, 3}},
+		{[]string{"svc-b"}, []int{0, 1}},
+		{[]string{"docs"}, []int{}},
+	}
+	for _, tt := range tests {
+		ts, err := (versioner{paths: tt.paths}).touching(cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int{}
+		for _, c := range ts {
+			for i := range cs {
+				if c.Hash == cs[i].Hash {
+					got = append(got, i)
+				}
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("paths %q: touching %v, want %v", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestTagConstraint(t *testing.T) {
+	tests := []struct {
+		tag        string
+		constraint bool
+		prefix     string
+	}{
+		{"v1.2.3", false, ""},
+		{"svc-a/v1.2.3", false, "svc-a/"},
+		{"svc-a/^1.2", true, "svc-a/"},
+		{"svc-a/1.x", true, "svc-a/"},
+		{"release-1.x", false, ""},
+		{"a/b/>=1.0 <2.0", true, "a/b/"},
+		{"^1.2", true, ""},
+	}
+	for _, tt := range tests {
+		if got := isConstraint(tt.tag); got != tt.constraint {
+			t.Errorf("isConstraint(%q) = %t, want %t", tt.tag, got, tt.constraint)
+		}
+		if !tt.constraint {
+			continue
+		}
+		prefix, _, err := tagConstraint(tt.tag)
+		if err != nil || prefix != tt.prefix {
+			t.Errorf("tagConstraint(%q) = %q, %v, want %q", tt.tag, prefix, err, tt.prefix)
+		}
+		id, ok := parseID("o/r@" + tt.tag + ":a.zip")
+		if !ok || id.tag != tt.tag || id.asset != "a.zip" {
+			t.Errorf("parseID of tag %q = %+v, %t", tt.tag, id, ok)
+		}
+	}
+}
+
+func TestMatchReleasePrefix(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id": 1, "tag_name": "v1.5.0"}, {"id": 2, "tag_name": "svc-a/v1.2.3"},
+			{"id": 3, "tag_name": "svc-a/v1.3.0"}, {"id": 4, "tag_name": "svc-b/v1.9.0"},
+			{"id": 5, "tag_name": "svc-a/v2.0.0"}, {"id": 6, "tag_name": "svc-a/v1.4.0-rc.1", "prerelease": true}]`)
+	}))
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+
+	tests := map[string]string{
+		"svc-a/^1.2":         "svc-a/v1.3.0",
+		"svc-a/1.2.x":        "svc-a/v1.2.3",
+		"svc-b/^1":           "svc-b/v1.9.0",
+		"svc-a/>=1.4.0-0 <2": "svc-a/v1.4.0-rc.1",
+		"^1":                 "v1.5.0",
+		"svc-c/^1":           "",
+	}
+	c := anonClient()
+	for tag, want := range tests {
+		r, err := c.MatchRelease(ident{org: "o", repo: "r", tag: tag})
+		switch {
+		case want == "" && err == nil:
+			t.Errorf("%s matched %s, want none", tag, r.GetTagName())
+		case want != "" && err != nil:
+			t.Errorf("%s: %s", tag, err)
+		case want != "" && r.GetTagName() != want:
+			t.Errorf("%s matched %s, want %s", tag, r.GetTagName(), want)
+		}
+	}
+}
+
+// toolServer serves the release v1 of o/r with the asset tool, listed in its
+// checksum manifest, and a signature of tool. Downloads of tool are counted.
+func toolServer(content string) (*httptest.Server, *int) {
+	h := sha256.Sum256([]byte(content))
+	manifest := fmt.Sprintf("%x  tool\n", h)
+	gets := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/releases/tags/v1"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": 1, "tag_name": "v1"}`)
+		case strings.HasSuffix(r.URL.Path, "/releases/1/assets"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `[{"id": 2, "name": "tool", "size": %d}, {"id": 3, "name": "SHA256SUMS", "size": %d},
+				{"id": 4, "name": "tool.sig", "size": 89}]`, len(content), len(manifest))
+		case strings.HasSuffix(r.URL.Path, "/releases/assets/2"):
+			*gets++
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, content)
+		case strings.HasSuffix(r.URL.Path, "/releases/assets/3"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, gets
+}
+
+func TestLockAssets(t *testing.T) {
+	srv, gets := toolServer("tool v1")
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("tool v1")))
+
+	// auto globs every asset but locks neither the manifest nor signatures
+	c := anonClient()
+	known := map[int64]string{}
+	lt := lockedTool{Source: "o/r@v1:*", Auto: true}
+	if err := lockAssets(c, &lt, known); err != nil {
+		t.Fatal(err)
+	}
+	if lt.Tag != "v1" || fmt.Sprint(lt.Assets) != fmt.Sprintf("[{tool 2 %s}]", sum) {
+		t.Errorf("locked %s %v, want v1 [{tool 2 %s}]", lt.Tag, lt.Assets, sum)
+	}
+	if *gets != 0 || known[2] != sum {
+		t.Errorf("hashed tool %d times, known %v, want the listed checksum", *gets, known)
+	}
+
+	lt = lockedTool{Source: "o/r@v1:" + sumsName}
+	if err := lockAssets(c, &lt, known); !isNotFound(err) {
+		t.Errorf("locked the checksum manifest as %v, %v", lt.Assets, err)
+	}
+}
+
+func TestCheckLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mf := filepath.Join(dir, "hubr.yaml")
+
+	lts := []lockedTool{{Source: "o/a@^1:a.zip", Extract: true}, {Source: "o/b:*", Auto: true, Tag: "v2"}}
+	if err := checkLock(mf, lts); err != nil {
+		t.Errorf("without a manifest: %s", err)
+	}
+
+	ioutil.WriteFile(mf, []byte("tools:\n- ident: o/a\n  version: ^1\n  asset: a.zip\n  extract: true\n- ident: o/b\n  auto: true\n"), 0644)
+	if err := checkLock(mf, lts); err != nil {
+		t.Errorf("lock of the manifest: %s", err)
+	}
+	for _, stale := range [][]lockedTool{
+		lts[:1],
+		{lts[1], lts[0]},
+		{{Source: "o/a@^1:a.zip"}, lts[1]},
+		{{Source: "o/a@^2:a.zip", Extract: true}, lts[1]},
+	} {
+		if err := checkLock(mf, stale); err == nil {
+			t.Errorf("lock %v of the manifest is not out of date", stale)
+		}
+	}
+}
+
+func TestLockedToolSynced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "tool"), []byte("tool v1"), 0755)
+
+	lt := lockedTool{Source: "o/r@^1:tool", Tag: "v1", Assets: []lockedAsset{{"tool", 2, "aa"}}}
+	in := func(f func(*installation)) installation {
+		in := installation{Source: "o/r@^1:tool", Tag: "v1",
+			Assets: []installedAsset{{Name: "tool", ID: 2, SHA256: "aa", Paths: []string{"tool"}}}}
+		f(&in)
+		return in
+	}
+	tests := []struct {
+		name string
+		in   installation
+		want bool
+	}{
+		{"same", in(func(*installation) {}), true},
+		{"tag", in(func(in *installation) { in.Tag = "v0" }), false},
+		{"checksum", in(func(in *installation) { in.Assets[0].SHA256 = "bb" }), false},
+		{"missing file", in(func(in *installation) { in.Assets[0].Paths = []string{"tool", "doc"} }), false},
+		{"options", in(func(in *installation) { in.Mode = "get" }), false},
+		{"no assets", in(func(in *installation) { in.Assets = nil }), false},
+	}
+	for _, tt := range tests {
+		if got := lt.synced(dir, tt.in); got != tt.want {
+			t.Errorf("%s: synced = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"a", "b"} {
+		ioutil.WriteFile(filepath.Join(dir, p), []byte(p), 0755)
+	}
+	is := []installation{
+		{Source: "o/a@^1:a", Tag: "v1", Assets: []installedAsset{{Name: "a", ID: 1, SHA256: "aa", Paths: []string{"a"}}}},
+		{Source: "o/b@^1:b", Tag: "v1", Assets: []installedAsset{{Name: "b", ID: 2, SHA256: "bb", Paths: []string{"b"}}}},
+	}
+	if err := saveInstalled(dir, is); err != nil {
+		t.Fatal(err)
+	}
+	mf := filepath.Join(dir, "hubr.yaml")
+	if err := saveLock(lockName(mf), []lockedTool{{Source: "o/a@^1:a", Tag: "v1", Assets: []lockedAsset{{"a", 1, "aa"}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only synced tools are locked, so nothing is downloaded
+	exists := func(p string) bool {
+		_, err := os.Lstat(filepath.Join(dir, p))
+		return err == nil
+	}
+	for _, args := range [][]string{{}, {"-prune", "-n"}} {
+		if err := syncDir(append([]string{"-f", mf, "-d", dir}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		if !exists("a") || !exists("b") {
+			t.Errorf("sync %q removed a tool", args)
+		}
+	}
+	if err := syncDir([]string{"-f", mf, "-d", dir, "-prune"}); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("a") || exists("b") {
+		t.Errorf("sync -prune kept a %t, b %t, want only a", exists("a"), exists("b"))
+	}
+	if is, err := loadInstalled(dir); err != nil || len(is) != 1 || is[0].Source != "o/a@^1:a" {
+		t.Errorf("installed after prune = %v, %v", is, err)
+	}
+}
+
+func TestInstallSourcesLockedChecksum(t *testing.T) {
+	srv, _ := toolServer("tool v1")
+	defer srv.Close()
+	defer func(u, d string) { githubURL, cacheDir = u, d }(githubURL, cacheDir)
+	githubURL, cacheDir = srv.URL, ""
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("tool v1")))
+
+	dir, err := ioutil.TempDir("", "hubr-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a release asset replaced since locking is rejected
+	in := installation{Source: "o/r@^1:tool", Mode: "get", Tag: "v1",
+		Assets: []installedAsset{{Name: "tool", ID: 2, SHA256: strings.Repeat("0", 64)}}}
+	err = installSources(anonClient(), 1, nil, dir, []installation{in})
+	if err == nil || !strings.Contains(err.Error(), "does not match the locked checksum") {
+		t.Errorf("installed with a mismatched checksum: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tool")); err == nil {
+		t.Error("installed tool with a mismatched checksum")
+	}
+
+	in.Assets[0].SHA256 = sum
+	is := []installation{in}
+	if err := installSources(anonClient(), 1, nil, dir, is); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "tool")); string(b) != "tool v1" {
+		t.Errorf("installed %q, want tool v1", b)
+	}
+	if is[0].Tag != "v1" || len(is[0].Assets) != 1 || is[0].Assets[0].SHA256 != sum {
+		t.Errorf("installation = %+v", is[0])
+	}
+}
+
+func TestReleaseSHA(t *testing.T) {
+	cs, cleanup := testRepo(t,
+		testCommit{map[string]string{"a": "1"}, []string{"v1.0.0!"}},
+		testCommit{map[string]string{"a": "2"}, nil},
+	)
+	defer cleanup()
+	defer setenv("GITHUB_ACTIONS", "true", "GITHUB_REPOSITORY", "o/r", "GITHUB_SHA", "abc")()
+
+	tests := []struct {
+		id   ident
+		want string
+	}{
+		{ident{org: "o", repo: "r", tag: "v1.0.0"}, cs[0].Hash.String()},
+		{ident{org: "o", repo: "r", tag: "v2.0.0"}, "abc"},
+		{ident{org: "O", repo: "R", tag: "v2.0.0"}, "abc"},
+		{ident{org: "o", repo: "other", tag: "v2.0.0"}, cs[1].Hash.String()},
+	}
+	for _, tt := range tests {
+		if got, err := releaseSHA(tt.id); err != nil || got != tt.want {
+			t.Errorf("releaseSHA(%s) = %s, %v, want %s", tt.id, got, err, tt.want)
+		}
+	}
+
+	// outside GitHub Actions the workflow commit is never used
+	defer setenv("GITHUB_ACTIONS", "")()
+	if got, _ := releaseSHA(tests[1].id); got != cs[1].Hash.String() {
+		t.Errorf("releaseSHA outside actions = %s, want head %s", got, cs[1].Hash)
+	}
+}